@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KMSVaultNamespaceConfigSpec defines the settings that apply to all KMSVaultSecrets in the same namespace
+// +k8s:openapi-gen=true
+type KMSVaultNamespaceConfigSpec struct {
+	// +listType=set
+	AllowedKMSKeys []string `json:"allowedKMSKeys,omitempty"`
+
+	// RequiredContextKeys are keys that must be in the encryption context of every secret in the namespace, in the
+	// form key or key=value, where value can be a template like {{ .Namespace }} or {{ .Labels.app }}.
+	// +listType=set
+	RequiredContextKeys []string `json:"requiredContextKeys,omitempty"`
+
+	Defaults KMSVaultSecretDefaults `json:"defaults,omitempty"`
+}
+
+// KMSVaultSecretDefaults are applied by the mutating webhook to the KMSVaultSecrets created in the namespace, and
+// take precedence over the cluster-wide defaults of the webhook.
+type KMSVaultSecretDefaults struct {
+	// AddDeleteFinalizer adds the delete.k8s.patoarvizu.dev finalizer, so secrets are removed from Vault when the
+	// object is deleted.
+	AddDeleteFinalizer *bool `json:"addDeleteFinalizer,omitempty"`
+	// EngineVersion is the KV engine version set on objects that don't set one, if it can't be detected from the
+	// mount of their path.
+	EngineVersion KVEngineVersion `json:"engineVersion,omitempty"`
+	// DetectEngineVersion looks up the KV engine version of the mount of the path in Vault.
+	DetectEngineVersion *bool `json:"detectEngineVersion,omitempty"`
+	// Labels are added to objects that don't already set them, e.g. to identify the team that owns them.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KMSVaultNamespaceConfig is the Schema for the kmsvaultnamespaceconfigs API
+// +k8s:openapi-gen=true
+// +kubebuilder:resource:path=kmsvaultnamespaceconfigs,scope=Namespaced,shortName=kmsvnc
+type KMSVaultNamespaceConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KMSVaultNamespaceConfigSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KMSVaultNamespaceConfigList contains a list of KMSVaultNamespaceConfig
+type KMSVaultNamespaceConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KMSVaultNamespaceConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KMSVaultNamespaceConfig{}, &KMSVaultNamespaceConfigList{})
+}
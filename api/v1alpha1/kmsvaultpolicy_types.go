@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KMSVaultPolicySpec defines which Vault paths, KV engines and KMS keys can be used by the KMSVaultSecrets in the
+// namespaces selected by the policy
+// +k8s:openapi-gen=true
+type KMSVaultPolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to. An empty selector selects all namespaces.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// AllowedPaths is a list of globs of the Vault paths that can be written to, where '*' matches any characters
+	// within a path segment and '**' matches across segments. An empty list allows any path.
+	// +listType=set
+	AllowedPaths []string `json:"allowedPaths,omitempty"`
+
+	// AllowedEngineVersions is the list of KV engine versions that can be used. An empty list allows any version.
+	// +listType=set
+	AllowedEngineVersions []KVEngineVersion `json:"allowedEngineVersions,omitempty"`
+
+	// +listType=set
+	AllowedKMSKeys []string `json:"allowedKMSKeys,omitempty"`
+
+	// AllowedKMSRoleARNs is a list of globs of the IAM roles that KMSVaultSecrets can assume with spec.kms.roleArn,
+	// with the same syntax as AllowedPaths. A KMSVaultSecret can only set a role if it's allowed by a policy that
+	// applies to it.
+	// +listType=set
+	AllowedKMSRoleARNs []string `json:"allowedKMSRoleARNs,omitempty"`
+}
+
+// +kubebuilder:validation:Enum={"v1","v2"}
+type KVEngineVersion string
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KMSVaultPolicy is the Schema for the kmsvaultpolicies API
+// +k8s:openapi-gen=true
+// +kubebuilder:resource:path=kmsvaultpolicies,scope=Cluster,shortName=kmsvp
+type KMSVaultPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KMSVaultPolicySpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// KMSVaultPolicyList contains a list of KMSVaultPolicy
+type KMSVaultPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KMSVaultPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KMSVaultPolicy{}, &KMSVaultPolicyList{})
+}
@@ -7,6 +7,8 @@ import (
 // KMSVaultSecretSpec defines the desired state of KMSVaultSecret
 // +k8s:openapi-gen=true
 type KMSVaultSecretSpec struct {
+	// Path is the Vault path the secret is written to. It's rendered as a Go template that can refer to
+	// {{ .Namespace }}, {{ .Name }}, {{ .Labels }} and {{ .Annotations }} of the object.
 	Path string `json:"path"`
 
 	// +listType=map
@@ -17,12 +19,36 @@ type KMSVaultSecretSpec struct {
 	// +listType=set
 	IncludeSecrets []string `json:"includeSecrets,omitempty"`
 
-	KVSettings KVSettings `json:"kvSettings"`
+	// Templates are values composed from the decrypted secrets of the object and the PartialKMSVaultSecrets it
+	// includes.
+	// +listType=map
+	// +listMapKey=key
+	Templates []Template `json:"templates,omitempty"`
+
+	KVSettings KVSettings `json:"kvSettings,omitempty"`
+
+	KMS KMSSettings `json:"kms,omitempty"`
+
+	// SyncInterval is the amount of time between syncs, as a duration like 10m or 1h30m, or never to only sync when
+	// the object changes. It's kept within the limits set on the operator, and defaults to its --sync-period-seconds.
+	// +kubebuilder:validation:Pattern=`^(never|([0-9]+(\.[0-9]+)?(ns|us|ms|s|m|h))+)$`
+	SyncInterval string `json:"syncInterval,omitempty"`
+}
+
+// KMSSettings controls which region and credentials are used to decrypt the secrets. If not set, the region and
+// credentials of the operator are used.
+type KMSSettings struct {
+	Region string `json:"region,omitempty"`
+	// +kubebuilder:validation:Pattern=`^arn:aws[a-z-]*:iam::[0-9]{12}:role/.+$`
+	RoleARN    string `json:"roleArn,omitempty"`
+	ExternalID string `json:"externalId,omitempty"`
 }
 
 type KVSettings struct {
+	// EngineVersion is the version of the KV engine mounted on the path. If not set, the mutating webhook sets it
+	// from its defaults, otherwise v1 is assumed.
 	// +kubebuilder:validation:Enum={"v1","v2"}
-	EngineVersion string `json:"engineVersion"`
+	EngineVersion string `json:"engineVersion,omitempty"`
 	// +kubebuilder:validation:Minimum=0
 	CASIndex int `json:"casIndex,omitempty"`
 }
@@ -32,12 +58,63 @@ type Secret struct {
 	EncryptedSecret string            `json:"encryptedSecret,omitempty"`
 	SecretContext   map[string]string `json:"secretContext,omitempty"`
 	EmptySecret     bool              `json:"emptySecret,omitempty"`
+	// Format is how the plaintext is parsed before it's written to Vault. A string is written as is, json and yaml
+	// are written as the object, list, number, etc. that they hold, and base64 is decoded and written as a string.
+	// +kubebuilder:validation:Enum={"string","json","yaml","base64"}
+	Format string `json:"format,omitempty"`
+	// OutputEncoding is how the value is written to Vault. With raw, it's written as is, and has to be valid UTF-8.
+	// With base64, it's written base64-encoded, which is how binary values are written. It can only be base64 if the
+	// format is string or base64.
+	// +kubebuilder:validation:Enum={"raw","base64"}
+	OutputEncoding string `json:"outputEncoding,omitempty"`
+	// TemplateOnly keeps the secret out of the data written to Vault, so it's only used by templates.
+	TemplateOnly bool `json:"templateOnly,omitempty"`
+	// Bundle makes the plaintext a document whose keys are written as separate secrets, instead of writing the
+	// plaintext to Key.
+	Bundle *Bundle `json:"bundle,omitempty"`
+}
+
+// Bundle is a dotenv, JSON or YAML document that is expanded into a secret for each of its keys.
+type Bundle struct {
+	// Format is the format of the document.
+	// +kubebuilder:validation:Enum={"dotenv","json","yaml"}
+	Format string `json:"format"`
+	// Envelope is set if encryptedSecret is an envelope, i.e. a document encrypted with a data key that is encrypted
+	// with KMS, for documents larger than what KMS can encrypt directly.
+	Envelope bool `json:"envelope,omitempty"`
+	// Prefix is added to the key of every secret of the bundle.
+	Prefix string `json:"prefix,omitempty"`
+	// Include are glob patterns of the keys that are written. If empty, every key is written.
+	Include []string `json:"include,omitempty"`
+	// Exclude are glob patterns of the keys that are not written, even if they match Include.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Template is a value that is rendered from the decrypted secrets.
+type Template struct {
+	// Key is the key the rendered value is written to.
+	Key string `json:"key"`
+	// Template is a Go template that can refer to the decrypted secrets by key, e.g. {{ .password }}. Secrets with
+	// the json or yaml format can be referred to by field, e.g. {{ .database.user }}.
+	Template string `json:"template"`
 }
 
 // KMSVaultSecretStatus defines the observed state of KMSVaultSecret
 // +k8s:openapi-gen=true
 type KMSVaultSecretStatus struct {
-	Created bool `json:"created,omitempty"`
+	Created            bool  `json:"created,omitempty"`
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Path is the rendered spec.path that the secret was last written to.
+	Path string `json:"path,omitempty"`
+	// PathTemplate is the spec.path that status.path was rendered from. The path is only rendered again when spec.path
+	// changes.
+	PathTemplate string `json:"pathTemplate,omitempty"`
+	// EngineVersion is the KV engine version that the secret was last written with.
+	EngineVersion string `json:"engineVersion,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -21,16 +21,235 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Bundle) DeepCopyInto(out *Bundle) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Bundle.
+func (in *Bundle) DeepCopy() *Bundle {
+	if in == nil {
+		return nil
+	}
+	out := new(Bundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSSettings) DeepCopyInto(out *KMSSettings) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSSettings.
+func (in *KMSSettings) DeepCopy() *KMSSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSVaultNamespaceConfig) DeepCopyInto(out *KMSVaultNamespaceConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultNamespaceConfig.
+func (in *KMSVaultNamespaceConfig) DeepCopy() *KMSVaultNamespaceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSVaultNamespaceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KMSVaultNamespaceConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSVaultNamespaceConfigList) DeepCopyInto(out *KMSVaultNamespaceConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KMSVaultNamespaceConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultNamespaceConfigList.
+func (in *KMSVaultNamespaceConfigList) DeepCopy() *KMSVaultNamespaceConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSVaultNamespaceConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KMSVaultNamespaceConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSVaultNamespaceConfigSpec) DeepCopyInto(out *KMSVaultNamespaceConfigSpec) {
+	*out = *in
+	if in.AllowedKMSKeys != nil {
+		in, out := &in.AllowedKMSKeys, &out.AllowedKMSKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequiredContextKeys != nil {
+		in, out := &in.RequiredContextKeys, &out.RequiredContextKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Defaults.DeepCopyInto(&out.Defaults)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultNamespaceConfigSpec.
+func (in *KMSVaultNamespaceConfigSpec) DeepCopy() *KMSVaultNamespaceConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSVaultNamespaceConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSVaultPolicy) DeepCopyInto(out *KMSVaultPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultPolicy.
+func (in *KMSVaultPolicy) DeepCopy() *KMSVaultPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSVaultPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KMSVaultPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSVaultPolicyList) DeepCopyInto(out *KMSVaultPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KMSVaultPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultPolicyList.
+func (in *KMSVaultPolicyList) DeepCopy() *KMSVaultPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSVaultPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KMSVaultPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSVaultPolicySpec) DeepCopyInto(out *KMSVaultPolicySpec) {
+	*out = *in
+	in.NamespaceSelector.DeepCopyInto(&out.NamespaceSelector)
+	if in.AllowedPaths != nil {
+		in, out := &in.AllowedPaths, &out.AllowedPaths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedEngineVersions != nil {
+		in, out := &in.AllowedEngineVersions, &out.AllowedEngineVersions
+		*out = make([]KVEngineVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedKMSKeys != nil {
+		in, out := &in.AllowedKMSKeys, &out.AllowedKMSKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedKMSRoleARNs != nil {
+		in, out := &in.AllowedKMSRoleARNs, &out.AllowedKMSRoleARNs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultPolicySpec.
+func (in *KMSVaultPolicySpec) DeepCopy() *KMSVaultPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSVaultPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KMSVaultSecret) DeepCopyInto(out *KMSVaultSecret) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultSecret.
@@ -51,6 +270,38 @@ func (in *KMSVaultSecret) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSVaultSecretDefaults) DeepCopyInto(out *KMSVaultSecretDefaults) {
+	*out = *in
+	if in.AddDeleteFinalizer != nil {
+		in, out := &in.AddDeleteFinalizer, &out.AddDeleteFinalizer
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DetectEngineVersion != nil {
+		in, out := &in.DetectEngineVersion, &out.DetectEngineVersion
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultSecretDefaults.
+func (in *KMSVaultSecretDefaults) DeepCopy() *KMSVaultSecretDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSVaultSecretDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KMSVaultSecretList) DeepCopyInto(out *KMSVaultSecretList) {
 	*out = *in
@@ -105,7 +356,13 @@ func (in *KMSVaultSecretSpec) DeepCopyInto(out *KMSVaultSecretSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = make([]Template, len(*in))
+		copy(*out, *in)
+	}
 	out.KVSettings = in.KVSettings
+	out.KMS = in.KMS
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultSecretSpec.
@@ -121,6 +378,13 @@ func (in *KMSVaultSecretSpec) DeepCopy() *KMSVaultSecretSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KMSVaultSecretStatus) DeepCopyInto(out *KMSVaultSecretStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSVaultSecretStatus.
@@ -261,6 +525,11 @@ func (in *Secret) DeepCopyInto(out *Secret) {
 			(*out)[key] = val
 		}
 	}
+	if in.Bundle != nil {
+		in, out := &in.Bundle, &out.Bundle
+		*out = new(Bundle)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Secret.
@@ -272,3 +541,18 @@ func (in *Secret) DeepCopy() *Secret {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Template) DeepCopyInto(out *Template) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Template.
+func (in *Template) DeepCopy() *Template {
+	if in == nil {
+		return nil
+	}
+	out := new(Template)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// textEdit replaces content[start:end] with text. Editing the original text instead of re-encoding the YAML nodes
+// keeps the comments, indentation and quoting of the rest of the file as they are.
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// source is the content of a YAML file, and the offset where each of its lines starts.
+type source struct {
+	content []byte
+	lines   []int
+}
+
+func newSource(content []byte) *source {
+	lines := []int{0}
+	for i, c := range content {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return &source{content: content, lines: lines}
+}
+
+// offset returns the offset of the first character of n.
+func (s *source) offset(n *yamlv3.Node) int {
+	return s.lines[n.Line-1] + n.Column - 1
+}
+
+// lineEnd returns the offset where the line after the one n starts on, or the end of the content.
+func (s *source) lineEnd(n *yamlv3.Node) int {
+	if n.Line < len(s.lines) {
+		return s.lines[n.Line]
+	}
+	return len(s.content)
+}
+
+// scalarEdit returns the edit that replaces the scalar n with value, keeping its quoting style. Only scalars on a
+// single line can be replaced.
+func (s *source) scalarEdit(n *yamlv3.Node, value string) (textEdit, error) {
+	start := s.offset(n)
+	end := -1
+	switch n.Style {
+	case 0:
+		if bytes.HasPrefix(s.content[start:], []byte(n.Value)) {
+			end = start + len(n.Value)
+		}
+	case yamlv3.DoubleQuotedStyle:
+		for i := start + 1; i < len(s.content) && s.content[i] != '\n'; i++ {
+			if s.content[i] == '\\' {
+				i++
+			} else if s.content[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+	case yamlv3.SingleQuotedStyle:
+		for i := start + 1; i < len(s.content) && s.content[i] != '\n'; i++ {
+			if s.content[i] == '\'' {
+				if i+1 < len(s.content) && s.content[i+1] == '\'' {
+					i++
+					continue
+				}
+				end = i + 1
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return textEdit{}, fmt.Errorf("Value on line %d can't be rewritten in place, it must be on a single line", n.Line)
+	}
+	return textEdit{start: start, end: end, text: quote(value, n.Style)}, nil
+}
+
+// quote formats value as a YAML scalar in style, or double-quoted if it can't be written as a plain scalar.
+func quote(value string, style yamlv3.Style) string {
+	switch style {
+	case yamlv3.SingleQuotedStyle:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	case 0:
+		plain, err := yamlv3.Marshal(value)
+		if err == nil && strings.Count(string(plain), "\n") == 1 && !strings.ContainsAny(string(plain[:1]), `"'|>`) {
+			return strings.TrimSuffix(string(plain), "\n")
+		}
+	}
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+// mappingEdits returns the edits that set and remove keys of the block mapping m. New keys are added before the
+// existing ones, with the same indentation.
+func (s *source) mappingEdits(m *yamlv3.Node, set map[string]string, remove map[string]bool) ([]textEdit, error) {
+	if m.Kind != yamlv3.MappingNode || m.Style&yamlv3.FlowStyle != 0 || len(m.Content) == 0 {
+		return nil, fmt.Errorf("Map on line %d can't be rewritten in place, it must be in block style", m.Line)
+	}
+	edits := []textEdit{}
+	existing := map[string]bool{}
+	remaining := 0
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		existing[k.Value] = true
+		if remove[k.Value] {
+			if k.Line != v.Line || v.Kind != yamlv3.ScalarNode || !s.onOwnLine(k) {
+				return nil, fmt.Errorf("Key %s on line %d can't be removed in place, it must be on its own line", k.Value, k.Line)
+			}
+			edits = append(edits, textEdit{start: s.lines[k.Line-1], end: s.lineEnd(v)})
+			continue
+		}
+		remaining++
+		if value, ok := set[k.Value]; ok && value != v.Value {
+			if v.Kind != yamlv3.ScalarNode {
+				return nil, fmt.Errorf("Value of key %s on line %d must be a string", k.Value, k.Line)
+			}
+			edit, err := s.scalarEdit(v, value)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, edit)
+		}
+	}
+	added := []string{}
+	for k, v := range set {
+		if !existing[k] && !remove[k] {
+			added = append(added, k+": "+quote(v, 0))
+		}
+	}
+	if remaining+len(added) == 0 {
+		return nil, fmt.Errorf("Map on line %d can't be left empty, remove it instead", m.Line)
+	}
+	if len(added) > 0 {
+		first := m.Content[0]
+		if !s.onOwnLine(first) {
+			return nil, fmt.Errorf("Map on line %d can't be rewritten in place, its first key must be on its own line", m.Line)
+		}
+		sort.Strings(added)
+		indent := strings.Repeat(" ", first.Column-1)
+		edits = append(edits, textEdit{start: s.lines[first.Line-1], end: s.lines[first.Line-1], text: indent + strings.Join(added, "\n"+indent) + "\n"})
+	}
+	return edits, nil
+}
+
+// addMappingEdit returns the edit that adds key to the block mapping m, with a block mapping of values under it.
+func (s *source) addMappingEdit(m *yamlv3.Node, key string, values map[string]string) (textEdit, error) {
+	if m.Kind != yamlv3.MappingNode || m.Style&yamlv3.FlowStyle != 0 || len(m.Content) == 0 || !s.onOwnLine(m.Content[0]) {
+		return textEdit{}, fmt.Errorf("Map on line %d can't be rewritten in place, it must be in block style", m.Line)
+	}
+	first := m.Content[0]
+	indent := strings.Repeat(" ", first.Column-1)
+	lines := []string{indent + key + ":"}
+	for k, v := range values {
+		lines = append(lines, indent+"  "+k+": "+quote(v, 0))
+	}
+	sort.Strings(lines[1:])
+	start := s.lines[first.Line-1]
+	return textEdit{start: start, end: start, text: strings.Join(lines, "\n") + "\n"}, nil
+}
+
+// onOwnLine reports whether n is the first thing on its line.
+func (s *source) onOwnLine(n *yamlv3.Node) bool {
+	return len(strings.TrimSpace(string(s.content[s.lines[n.Line-1]:s.offset(n)]))) == 0
+}
+
+// apply returns the content with edits applied. Edits can't overlap.
+func (s *source) apply(edits []textEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start > edits[j].start
+		}
+		return edits[i].end > edits[j].end
+	})
+	content := append([]byte{}, s.content...)
+	for _, e := range edits {
+		content = append(content[:e.start], append([]byte(e.text), content[e.end:]...)...)
+	}
+	return content
+}
+
+// mappingValue returns the value of key in the mapping m, or nil if it's not set.
+func mappingValue(m *yamlv3.Node, key string) *yamlv3.Node {
+	if m == nil || m.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// parseSource parses content and returns it as a source, along with the mapping at the top of its first document.
+func parseSource(t *testing.T, content string) (*source, *yamlv3.Node) {
+	doc := &yamlv3.Node{}
+	if err := yamlv3.Unmarshal([]byte(content), doc); err != nil {
+		t.Fatal(err)
+	}
+	return newSource([]byte(content)), doc.Content[0]
+}
+
+func TestScalarEdit(t *testing.T) {
+	for name, tc := range map[string]struct {
+		content  string
+		value    string
+		expected string
+	}{
+		"plain":                      {"value: old # comment\n", "new", "value: new # comment\n"},
+		"plain that must be quoted":  {"value: old\n", "yes: no", "value: \"yes: no\"\n"},
+		"double quoted":              {"value: \"o\\\"ld\" # comment\n", "new", "value: \"new\" # comment\n"},
+		"single quoted":              {"value: 'o''ld'\nother: x\n", "it's", "value: 'it''s'\nother: x\n"},
+		"last line without new line": {"value: old", "new", "value: new"},
+	} {
+		src, m := parseSource(t, tc.content)
+		edit, err := src.scalarEdit(mappingValue(m, "value"), tc.value)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if out := string(src.apply([]textEdit{edit})); out != tc.expected {
+			t.Errorf("%s: expected %q, got %q", name, tc.expected, out)
+		}
+	}
+	src, m := parseSource(t, "value: |\n  old\n")
+	if _, err := src.scalarEdit(mappingValue(m, "value"), "new"); err == nil {
+		t.Error("Expected an error replacing a block scalar")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		style    yamlv3.Style
+		expected string
+	}{
+		{"AQICAHh+/abc==", 0, "AQICAHh+/abc=="},
+		{"true", 0, `"true"`},
+		{"", 0, `""`},
+		{"multi\nline", 0, `"multi\nline"`},
+		{"it's", yamlv3.SingleQuotedStyle, "'it''s'"},
+		{"plain", yamlv3.DoubleQuotedStyle, `"plain"`},
+	} {
+		if quoted := quote(tc.value, tc.style); quoted != tc.expected {
+			t.Errorf("Expected %q quoted to be %s, got %s", tc.value, tc.expected, quoted)
+		}
+	}
+}
+
+func TestMappingEdits(t *testing.T) {
+	content := "context:\n  # keep this comment\n  app: web\n  env: staging\n  team: a\n"
+	for name, tc := range map[string]struct {
+		set      map[string]string
+		remove   map[string]bool
+		expected string
+	}{
+		"set existing": {map[string]string{"env": "production"}, nil, "context:\n  # keep this comment\n  app: web\n  env: production\n  team: a\n"},
+		"add":          {map[string]string{"region": "us-east-1", "owner": "b"}, nil, "context:\n  # keep this comment\n  owner: b\n  region: us-east-1\n  app: web\n  env: staging\n  team: a\n"},
+		"remove":       {nil, map[string]bool{"env": true}, "context:\n  # keep this comment\n  app: web\n  team: a\n"},
+		"unchanged":    {map[string]string{"app": "web"}, nil, content},
+	} {
+		src, m := parseSource(t, content)
+		edits, err := src.mappingEdits(mappingValue(m, "context"), tc.set, tc.remove)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if out := string(src.apply(edits)); out != tc.expected {
+			t.Errorf("%s: expected %q, got %q", name, tc.expected, out)
+		}
+	}
+	for name, tc := range map[string]struct {
+		content string
+		remove  map[string]bool
+	}{
+		"flow style":          {"context: {app: web}\n", nil},
+		"left empty":          {"context:\n  app: web\n", map[string]bool{"app": true}},
+		"not on its own line": {"context: {app: web, env: staging}\n", map[string]bool{"env": true}},
+	} {
+		src, m := parseSource(t, tc.content)
+		if _, err := src.mappingEdits(mappingValue(m, "context"), map[string]string{}, tc.remove); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAddMappingEdit(t *testing.T) {
+	src, m := parseSource(t, "spec:\n  path: secret/app\n")
+	edit, err := src.addMappingEdit(mappingValue(m, "spec"), "secretContext", map[string]string{"env": "production", "app": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "spec:\n  secretContext:\n    app: web\n    env: production\n  path: secret/app\n"
+	if out := string(src.apply([]textEdit{edit})); out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestApply(t *testing.T) {
+	src := newSource([]byte("0123456789"))
+	out := src.apply([]textEdit{{start: 1, end: 3, text: "ab"}, {start: 8, end: 8, text: "X"}, {start: 5, end: 6, text: ""}})
+	if string(out) != "0ab3467X89" {
+		t.Errorf("Unexpected content %s", out)
+	}
+	if string(src.content) != "0123456789" {
+		t.Errorf("Expected the source to be left as is, got %s", src.content)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"sigs.k8s.io/yaml"
+)
+
+// encrypt encrypts a single value, given as an argument, with -file or on stdin, and prints it as an entry of
+// spec.secrets.
+func encrypt(args []string) error {
+	fl := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintf(fl.Output(), "Usage: kmsvault encrypt -key-id <key> -key <name> [flags] [value]\n\nThe value is read from -file, the argument, or stdin (without its trailing newline), in that order.\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	e := &encryptionFlags{}
+	e.register(fl)
+	key := fl.String("key", "", "Key of the secret entry")
+	file := fl.String("file", "", "File to read the value from, as is")
+	valueFormat := fl.String("format", "", "Format of the value, either string, json, yaml or base64, which is checked before encrypting it")
+	outputEncoding := fl.String("output-encoding", "", "Encoding the value is written to Vault with, either raw or base64 for binary values")
+	bundleFormat := fl.String("bundle", "", "Encrypt the value as a bundle of secrets, in either dotenv, json or yaml format")
+	envelope := fl.Bool("envelope", false, "Encrypt the bundle in an envelope, for bundles larger than the 4 KB that KMS can encrypt")
+	fl.Parse(args)
+
+	if len(*key) == 0 {
+		return errors.New("-key is required")
+	}
+	if len(*bundleFormat) > 0 && len(*valueFormat) > 0 {
+		return errors.New("-format and -bundle can't be used together")
+	}
+	if *envelope && len(*bundleFormat) == 0 {
+		return errors.New("-envelope can only be used with -bundle")
+	}
+	encryptionContext, err := e.encryptionContext()
+	if err != nil {
+		return err
+	}
+	value, err := readValue(*file, fl.Args())
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return errors.New("The value is empty, use emptySecret: true instead")
+	}
+	err = checkValue(value, *valueFormat, *outputEncoding, *bundleFormat)
+	if err != nil {
+		return fmt.Errorf("The value %v", err)
+	}
+	svc, err := e.kmsClient()
+	if err != nil {
+		return err
+	}
+	var ciphertext string
+	if *envelope {
+		var sealed []byte
+		sealed, err = kmsutil.SealEnvelope(svc, e.keyID, value, encryptionContext)
+		ciphertext = base64.StdEncoding.EncodeToString(sealed)
+	} else {
+		ciphertext, err = encryptValue(svc, e.keyID, value, encryptionContext)
+	}
+	if err != nil {
+		return err
+	}
+	secret := kmsvaultv1alpha1.Secret{
+		Key:             *key,
+		EncryptedSecret: ciphertext,
+		Format:          *valueFormat,
+		OutputEncoding:  *outputEncoding,
+	}
+	if len(*bundleFormat) > 0 {
+		secret.Bundle = &kmsvaultv1alpha1.Bundle{Format: *bundleFormat, Envelope: *envelope}
+	}
+	if len(encryptionContext) > 0 {
+		secret.SecretContext = encryptionContext
+	}
+	out, err := yaml.Marshal([]kmsvaultv1alpha1.Secret{secret})
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// checkValue checks that value can be written by the operator, either as a value of valueFormat, or as a bundle of
+// bundleFormat if it's set.
+func checkValue(value []byte, valueFormat string, outputEncoding string, bundleFormat string) error {
+	values := map[string]interface{}{}
+	if len(bundleFormat) > 0 {
+		var err error
+		values, err = format.ExpandBundle(bundleFormat, value, "", nil, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		parsed, err := format.Parse(valueFormat, value)
+		if err != nil {
+			return err
+		}
+		values[""] = parsed
+	}
+	for k, v := range values {
+		_, err := format.Encode(outputEncoding, v)
+		if err != nil && len(k) > 0 {
+			return fmt.Errorf("key %s %v", k, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readValue(file string, args []string) ([]byte, error) {
+	if len(file) > 0 {
+		return ioutil.ReadFile(file)
+	}
+	if len(args) > 1 {
+		return nil, errors.New("Only one value can be encrypted at a time")
+	}
+	if len(args) == 1 {
+		return []byte(args[0]), nil
+	}
+	value, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSuffix(strings.TrimSuffix(string(value), "\n"), "\r")), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestCheckValue(t *testing.T) {
+	for name, tc := range map[string]struct {
+		value          string
+		valueFormat    string
+		outputEncoding string
+		bundleFormat   string
+		valid          bool
+	}{
+		"string":                {"secret", "", "", "", true},
+		"json":                  {`{"user": "app"}`, "json", "", "", true},
+		"invalid json":          {`{"user": `, "json", "", "", false},
+		"binary":                {"\xff\xfe", "", "", "", false},
+		"binary as base64":      {"\xff\xfe", "", "base64", "", true},
+		"structured as base64":  {`{"user": "app"}`, "json", "base64", "", false},
+		"bundle":                {"USER=app\nPASSWORD=secret\n", "", "", "dotenv", true},
+		"invalid bundle":        {"not a bundle", "", "", "json", false},
+		"bundle with a binary":  {"USER=\xff\n", "", "", "dotenv", false},
+		"unknown output format": {"secret", "", "hex", "", false},
+	} {
+		err := checkValue([]byte(tc.value), tc.valueFormat, tc.outputEncoding, tc.bundleFormat)
+		if tc.valid && err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+)
+
+type command struct {
+	run         func(args []string) error
+	description string
+}
+
+var commands = map[string]command{
+	"encrypt":   {run: encrypt, description: "Encrypt a value and print it as an entry of spec.secrets"},
+	"reencrypt": {run: reencrypt, description: "Re-encrypt the values in manifest files under a new KMS key, rewriting them in place"},
+	"seal":      {run: seal, description: "Encrypt a plaintext YAML or .env file into a KMSVaultSecret or PartialKMSVaultSecret manifest"},
+	"validate":  {run: validate, description: "Run the checks of the validating webhook on manifest files"},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: kmsvault <command> [flags]\n\nCommands:\n")
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-11s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'kmsvault <command> -h' for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	err := cmd.run(os.Args[2:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// contextFlag is a repeatable key=value flag that builds an encryption context.
+type contextFlag map[string]string
+
+func (c contextFlag) String() string {
+	entries := []string{}
+	for k, v := range c {
+		entries = append(entries, k+"="+v)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+func (c contextFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || len(kv[0]) == 0 {
+		return fmt.Errorf("Invalid encryption context entry %s, it must be key=value", value)
+	}
+	c[kv[0]] = kv[1]
+	return nil
+}
+
+// encryptionFlags are the flags shared by the commands that encrypt values.
+type encryptionFlags struct {
+	keyID         string
+	region        string
+	roleARN       string
+	externalID    string
+	context       contextFlag
+	namespace     string
+	name          string
+	bindNamespace bool
+	bindName      bool
+}
+
+func (e *encryptionFlags) register(fl *flag.FlagSet) {
+	e.context = contextFlag{}
+	fl.StringVar(&e.keyID, "key-id", "", "Id, ARN or alias of the KMS key to encrypt with")
+	fl.StringVar(&e.region, "region", "", "AWS region of the KMS key, defaults to the region of the environment")
+	fl.StringVar(&e.roleARN, "role-arn", "", "ARN of an IAM role to assume to encrypt")
+	fl.StringVar(&e.externalID, "external-id", "", "External id to assume -role-arn with")
+	fl.Var(e.context, "context", "Encryption context entry as key=value, can be repeated")
+	fl.StringVar(&e.namespace, "namespace", "", "Namespace of the object the value is for")
+	fl.StringVar(&e.name, "name", "", "Name of the KMSVaultSecret the value is for")
+	fl.BoolVar(&e.bindNamespace, "bind-namespace", false, "Add kubernetes_namespace=<namespace> to the encryption context, like the operator does with --inject-namespace-context")
+	fl.BoolVar(&e.bindName, "bind-name", false, "Also add kubernetes_name=<name> to the encryption context, like the operator does with --inject-name-context")
+}
+
+// encryptionContext returns the -context entries, with the namespace and name bindings added on top.
+func (e *encryptionFlags) encryptionContext() (map[string]string, error) {
+	if len(e.keyID) == 0 {
+		return nil, errors.New("-key-id is required")
+	}
+	if e.bindNamespace && len(e.namespace) == 0 {
+		return nil, errors.New("-bind-namespace requires -namespace")
+	}
+	if e.bindName && (!e.bindNamespace || len(e.name) == 0) {
+		return nil, errors.New("-bind-name requires -bind-namespace and -name")
+	}
+	encryptionContext := map[string]string{}
+	for k, v := range e.context {
+		encryptionContext[k] = v
+	}
+	if e.bindNamespace {
+		for k, v := range kmsutil.ObjectContext(e.namespace, e.name, e.bindName) {
+			encryptionContext[k] = v
+		}
+	}
+	return encryptionContext, nil
+}
+
+func (e *encryptionFlags) clientConfig() kmsutil.ClientConfig {
+	return kmsutil.ClientConfig{
+		Region:     e.region,
+		RoleARN:    e.roleARN,
+		ExternalID: e.externalID,
+	}
+}
+
+func (e *encryptionFlags) kmsClient() (kmsiface.KMSAPI, error) {
+	clients, err := kmsutil.NewClientCache()
+	if err != nil {
+		return nil, err
+	}
+	return clients.Client(e.clientConfig()), nil
+}
+
+// encryptValue encrypts plaintext with kms:Encrypt and returns the base64-encoded ciphertext, as expected in
+// encryptedSecret.
+func encryptValue(svc kmsiface.KMSAPI, keyID string, plaintext []byte, encryptionContext map[string]string) (string, error) {
+	input := &kms.EncryptInput{
+		KeyId:     aws.String(keyID),
+		Plaintext: plaintext,
+	}
+	if len(encryptionContext) > 0 {
+		input.EncryptionContext = aws.StringMap(encryptionContext)
+	}
+	output, err := svc.Encrypt(input)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(output.CiphertextBlob), nil
+}
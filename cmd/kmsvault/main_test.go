@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestContextFlag(t *testing.T) {
+	c := contextFlag{}
+	for _, value := range []string{"app=web", "empty=", "with=equals=sign"} {
+		if err := c.Set(value); err != nil {
+			t.Errorf("Unexpected error setting %s: %v", value, err)
+		}
+	}
+	expected := contextFlag{"app": "web", "empty": "", "with": "equals=sign"}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Expected %v, got %v", expected, c)
+	}
+	if c.String() != "app=web,empty=,with=equals=sign" {
+		t.Errorf("Unexpected string %s", c.String())
+	}
+	for _, value := range []string{"app", "=web"} {
+		if err := c.Set(value); err == nil {
+			t.Errorf("Expected an error setting %s", value)
+		}
+	}
+}
+
+func TestEncryptionContext(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		expected map[string]string
+		fails    bool
+	}{
+		"no key":                        {[]string{"-context", "app=web"}, nil, true},
+		"context":                       {[]string{"-key-id", "alias/app", "-context", "app=web"}, map[string]string{"app": "web"}, false},
+		"bound to the namespace":        {[]string{"-key-id", "alias/app", "-namespace", "team-a", "-bind-namespace"}, map[string]string{"kubernetes_namespace": "team-a"}, false},
+		"bound to the name":             {[]string{"-key-id", "alias/app", "-namespace", "team-a", "-name", "app", "-bind-namespace", "-bind-name"}, map[string]string{"kubernetes_namespace": "team-a", "kubernetes_name": "app"}, false},
+		"binding overrides the context": {[]string{"-key-id", "alias/app", "-context", "kubernetes_namespace=other", "-namespace", "team-a", "-bind-namespace"}, map[string]string{"kubernetes_namespace": "team-a"}, false},
+		"namespace missing":             {[]string{"-key-id", "alias/app", "-bind-namespace"}, nil, true},
+		"name without namespace":        {[]string{"-key-id", "alias/app", "-name", "app", "-bind-name"}, nil, true},
+	} {
+		fl := flag.NewFlagSet(name, flag.ContinueOnError)
+		e := &encryptionFlags{}
+		e.register(fl)
+		if err := fl.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+		encryptionContext, err := e.encryptionContext()
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(encryptionContext, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, encryptionContext)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/validation"
+	"github.com/pmezard/go-difflib/difflib"
+	yamlv3 "gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// listFlag is a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// document is a YAML document of a manifest file, and the object it decodes to.
+type document struct {
+	node *yamlv3.Node
+	obj  client.Object
+}
+
+type reencrypter struct {
+	keyID        string
+	clientConfig kmsutil.ClientConfig
+	clients      *kmsutil.ClientCache
+	rules        validation.Rules
+	set          map[string]string
+	remove       map[string]bool
+	secrets      []*kmsvaultv1alpha1.KMSVaultSecret
+}
+
+// reencrypt re-encrypts every encryptedSecret in the given files under a new KMS key with kms:ReEncrypt, optionally
+// changing their encryption context, and rewrites the files in place.
+func reencrypt(args []string) error {
+	fl := flag.NewFlagSet("reencrypt", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintf(fl.Output(), "Usage: kmsvault reencrypt -key-id <key> [flags] <file>...\n\nOnly the re-encrypted values (and the encryption contexts, if changed) are rewritten, the rest of the files is kept as is.\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	r := &reencrypter{set: contextFlag{}, remove: map[string]bool{}}
+	fl.StringVar(&r.keyID, "key-id", "", "Id, ARN or alias of the KMS key to re-encrypt with")
+	fl.StringVar(&r.clientConfig.Region, "region", "", "AWS region of the KMS keys, defaults to spec.kms.region of each object or the region of the environment")
+	fl.StringVar(&r.clientConfig.RoleARN, "role-arn", "", "ARN of an IAM role to assume to re-encrypt, defaults to spec.kms.roleArn of each object")
+	fl.StringVar(&r.clientConfig.ExternalID, "external-id", "", "External id to assume -role-arn with")
+	fl.Var(contextFlag(r.set), "context", "Encryption context entry to set as key=value, can be repeated")
+	remove := listFlag{}
+	fl.Var(&remove, "remove-context", "Encryption context key to remove, can be repeated")
+	namespace := fl.String("namespace", "default", "Namespace of the objects that don't set one")
+	fl.BoolVar(&r.rules.InjectNamespaceContext, "inject-namespace-context", false, "The values were encrypted with kubernetes_namespace=<namespace> added to their encryption context, like the operator does with --inject-namespace-context")
+	fl.BoolVar(&r.rules.InjectNameContext, "inject-name-context", false, "The values were also encrypted with kubernetes_name=<name>, like the operator does with --inject-name-context")
+	dryRun := fl.Bool("dry-run", false, "Print a diff of the changes instead of writing them")
+	fl.Parse(args)
+
+	if len(r.keyID) == 0 {
+		return errors.New("-key-id is required")
+	}
+	if fl.NArg() == 0 {
+		fl.Usage()
+		os.Exit(2)
+	}
+	for _, k := range remove {
+		r.remove[k] = true
+	}
+	var err error
+	r.clients, err = kmsutil.NewClientCache()
+	if err != nil {
+		return err
+	}
+	contents := map[string][]byte{}
+	documents := map[string][]document{}
+	for _, file := range fl.Args() {
+		contents[file], err = ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		documents[file], err = readDocuments(contents[file], *namespace)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %w", file, err)
+		}
+		for _, d := range documents[file] {
+			if secret, ok := d.obj.(*kmsvaultv1alpha1.KMSVaultSecret); ok {
+				r.secrets = append(r.secrets, secret)
+			}
+		}
+	}
+
+	outputs := map[string][]byte{}
+	counts := map[string]int{}
+	for _, file := range fl.Args() {
+		src := newSource(contents[file])
+		edits := []textEdit{}
+		for _, d := range documents[file] {
+			e, n, err := r.objectEdits(src, d)
+			if err != nil {
+				return fmt.Errorf("Error re-encrypting %s %s/%s in %s: %w", d.obj.GetObjectKind().GroupVersionKind().Kind, d.obj.GetNamespace(), d.obj.GetName(), file, err)
+			}
+			edits = append(edits, e...)
+			counts[file] += n
+		}
+		outputs[file] = src.apply(edits)
+	}
+	for _, file := range fl.Args() {
+		if *dryRun {
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(string(contents[file])),
+				B:        difflib.SplitLines(string(outputs[file])),
+				FromFile: file,
+				ToFile:   file,
+				Context:  3,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Print(diff)
+			continue
+		}
+		if !bytes.Equal(outputs[file], contents[file]) {
+			info, err := os.Stat(file)
+			if err != nil {
+				return err
+			}
+			err = ioutil.WriteFile(file, outputs[file], info.Mode().Perm())
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: re-encrypted %d values\n", file, counts[file])
+	}
+	return nil
+}
+
+// readDocuments decodes the KMSVaultSecrets and PartialKMSVaultSecrets in a file with one or more YAML documents,
+// keeping their nodes to know where each value is in the file.
+func readDocuments(content []byte, defaultNamespace string) ([]document, error) {
+	documents := []document{}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(content))
+	for {
+		node := &yamlv3.Node{}
+		err := decoder.Decode(node)
+		if err == io.EOF {
+			return documents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Content) == 0 {
+			continue
+		}
+		var obj client.Object
+		switch kind := mappingValue(node.Content[0], "kind"); {
+		case kind == nil:
+			continue
+		case kind.Value == "KMSVaultSecret":
+			obj = &kmsvaultv1alpha1.KMSVaultSecret{}
+		case kind.Value == "PartialKMSVaultSecret":
+			obj = &kmsvaultv1alpha1.PartialKMSVaultSecret{}
+		default:
+			continue
+		}
+		raw, err := yamlv3.Marshal(node.Content[0])
+		if err != nil {
+			return nil, err
+		}
+		err = yaml.Unmarshal(raw, obj)
+		if err != nil {
+			return nil, err
+		}
+		if len(obj.GetNamespace()) == 0 {
+			obj.SetNamespace(defaultNamespace)
+		}
+		documents = append(documents, document{node: node, obj: obj})
+	}
+}
+
+// objectEdits re-encrypts the secrets of the object in d, and returns the edits that replace them in src, along with
+// the number of secrets re-encrypted.
+func (r *reencrypter) objectEdits(src *source, d document) ([]textEdit, int, error) {
+	var secrets []kmsvaultv1alpha1.Secret
+	var secretContext map[string]string
+	var owner metav1.Object
+	config := kmsutil.ClientConfig{}
+	// The spec.secretContext of the object is only edited if it's the one the operator decrypts some of the secrets
+	// with, which is always the case for a KMSVaultSecret that includes partials.
+	usesSecretContext := false
+	editsSecretContext := true
+	switch obj := d.obj.(type) {
+	case *kmsvaultv1alpha1.KMSVaultSecret:
+		secrets, secretContext, owner = obj.Spec.Secrets, obj.Spec.SecretContext, obj
+		config = validation.ClientConfig(obj)
+		usesSecretContext = len(obj.Spec.IncludeSecrets) > 0
+	case *kmsvaultv1alpha1.PartialKMSVaultSecret:
+		secrets, secretContext, owner = obj.Spec.Secrets, obj.Spec.SecretContext, obj
+		// The secrets of a partial are decrypted with the KMS settings, name and secretContext of the
+		// KMSVaultSecret that includes it, so its own secretContext is ignored, and left as is.
+		if secret := r.includedBy(obj); secret != nil {
+			secretContext, config, owner = secret.Spec.SecretContext, validation.ClientConfig(secret), secret
+			editsSecretContext = false
+		}
+	}
+	if r.clientConfig != (kmsutil.ClientConfig{}) {
+		config = r.clientConfig
+	}
+	svc := r.clients.Client(config)
+	injected := validation.InjectedContext(owner, r.rules)
+	spec := mappingValue(d.node.Content[0], "spec")
+	secretsNode := mappingValue(spec, "secrets")
+	if secretsNode == nil || len(secretsNode.Content) != len(secrets) {
+		return nil, 0, nil
+	}
+	edits := []textEdit{}
+	count := 0
+	for i, s := range secrets {
+		entry := secretsNode.Content[i]
+		ciphertextNode := mappingValue(entry, "encryptedSecret")
+		if s.EmptySecret || ciphertextNode == nil {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s.EncryptedSecret)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error decoding key %s: %w", s.Key, err)
+		}
+		// Only the data key of an envelope is encrypted with KMS, so it's the only part that is re-encrypted.
+		ciphertext := decoded
+		var envelope *kmsutil.Envelope
+		if s.Bundle != nil && s.Bundle.Envelope {
+			envelope, err = kmsutil.ParseEnvelope(decoded)
+			if err != nil {
+				return nil, 0, fmt.Errorf("Error decoding key %s: %w", s.Key, err)
+			}
+			ciphertext = envelope.Key
+		}
+		var destinationContext map[string]*string
+		if len(s.SecretContext) > 0 {
+			destinationContext = validation.ApplicableContext(r.updatedContext(s.SecretContext), nil, injected)
+			if r.changesContext() {
+				e, err := src.mappingEdits(mappingValue(entry, "secretContext"), r.set, r.remove)
+				if err != nil {
+					return nil, 0, err
+				}
+				edits = append(edits, e...)
+			}
+		} else {
+			destinationContext = validation.ApplicableContext(nil, r.updatedContext(secretContext), injected)
+			usesSecretContext = true
+		}
+		output, err := svc.ReEncrypt(&kms.ReEncryptInput{
+			CiphertextBlob:               ciphertext,
+			SourceEncryptionContext:      validation.ApplicableContext(s.SecretContext, secretContext, injected),
+			DestinationKeyId:             aws.String(r.keyID),
+			DestinationEncryptionContext: destinationContext,
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error re-encrypting key %s: %w", s.Key, err)
+		}
+		reencrypted := output.CiphertextBlob
+		if envelope != nil {
+			envelope.Key = output.CiphertextBlob
+			reencrypted, err = json.Marshal(envelope)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+		edit, err := src.scalarEdit(ciphertextNode, base64.StdEncoding.EncodeToString(reencrypted))
+		if err != nil {
+			return nil, 0, err
+		}
+		edits = append(edits, edit)
+		count++
+	}
+	if usesSecretContext && editsSecretContext && r.changesContext() {
+		if contextNode := mappingValue(spec, "secretContext"); contextNode != nil {
+			e, err := src.mappingEdits(contextNode, r.set, r.remove)
+			if err != nil {
+				return nil, 0, err
+			}
+			edits = append(edits, e...)
+		} else if updated := r.updatedContext(nil); len(updated) > 0 {
+			edit, err := src.addMappingEdit(spec, "secretContext", updated)
+			if err != nil {
+				return nil, 0, err
+			}
+			edits = append(edits, edit)
+		}
+	}
+	return edits, count, nil
+}
+
+// includedBy returns the first KMSVaultSecret in the files that includes partial, or nil if none does.
+func (r *reencrypter) includedBy(partial *kmsvaultv1alpha1.PartialKMSVaultSecret) *kmsvaultv1alpha1.KMSVaultSecret {
+	for _, s := range r.secrets {
+		if s.Namespace != partial.Namespace {
+			continue
+		}
+		for _, i := range s.Spec.IncludeSecrets {
+			if i == partial.Name {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+func (r *reencrypter) changesContext() bool {
+	return len(r.set) > 0 || len(r.remove) > 0
+}
+
+// updatedContext returns a copy of encryptionContext with the -context entries set and the -remove-context keys
+// removed.
+func (r *reencrypter) updatedContext(encryptionContext map[string]string) map[string]string {
+	updated := map[string]string{}
+	for k, v := range encryptionContext {
+		updated[k] = v
+	}
+	for k, v := range r.set {
+		updated[k] = v
+	}
+	for k := range r.remove {
+		delete(updated, k)
+	}
+	return updated
+}
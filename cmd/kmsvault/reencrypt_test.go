@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/validation"
+)
+
+// reencryptKMS re-encrypts a ciphertext by prefixing it with the destination key, and records the calls it receives.
+type reencryptKMS struct {
+	kmsiface.KMSAPI
+	inputs []*kms.ReEncryptInput
+}
+
+func (k *reencryptKMS) ReEncrypt(input *kms.ReEncryptInput) (*kms.ReEncryptOutput, error) {
+	k.inputs = append(k.inputs, input)
+	return &kms.ReEncryptOutput{CiphertextBlob: append([]byte(*input.DestinationKeyId+":"), input.CiphertextBlob...)}, nil
+}
+
+func testReencrypter(t *testing.T, svc kmsiface.KMSAPI) *reencrypter {
+	clients, err := kmsutil.NewClientCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients.SetClient(kmsutil.ClientConfig{}, svc)
+	return &reencrypter{keyID: "alias/new", clients: clients, set: map[string]string{}, remove: map[string]bool{}}
+}
+
+func encoded(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+const reencryptManifests = `apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: KMSVaultSecret
+metadata:
+  name: app
+spec:
+  path: secret/app
+  includeSecrets:
+  - shared
+  secretContext:
+    env: staging
+  secrets:
+  - key: password
+    encryptedSecret: ` + "c2VjcmV0" + ` # keep this comment
+  - key: token
+    encryptedSecret: "dG9rZW4="
+    secretContext:
+      scope: token
+  - key: empty
+    emptySecret: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: PartialKMSVaultSecret
+metadata:
+  name: shared
+spec:
+  secrets:
+  - key: shared
+    encryptedSecret: c2hhcmVk
+`
+
+func TestReadDocuments(t *testing.T) {
+	documents, err := readDocuments([]byte(reencryptManifests), "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != 2 {
+		t.Fatalf("Expected 2 documents, got %d", len(documents))
+	}
+	secret, ok := documents[0].obj.(*kmsvaultv1alpha1.KMSVaultSecret)
+	if !ok || secret.Namespace != "team-a" || len(secret.Spec.Secrets) != 3 {
+		t.Errorf("Unexpected KMSVaultSecret %+v", documents[0].obj)
+	}
+	if _, ok := documents[1].obj.(*kmsvaultv1alpha1.PartialKMSVaultSecret); !ok {
+		t.Errorf("Expected a PartialKMSVaultSecret, got %T", documents[1].obj)
+	}
+}
+
+func TestObjectEdits(t *testing.T) {
+	for name, tc := range map[string]struct {
+		set      map[string]string
+		remove   map[string]bool
+		rules    validation.Rules
+		expected string
+		contexts []map[string]string
+	}{
+		"same context": {
+			expected: `apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: KMSVaultSecret
+metadata:
+  name: app
+spec:
+  path: secret/app
+  includeSecrets:
+  - shared
+  secretContext:
+    env: staging
+  secrets:
+  - key: password
+    encryptedSecret: ` + encoded("alias/new:secret") + ` # keep this comment
+  - key: token
+    encryptedSecret: "` + encoded("alias/new:token") + `"
+    secretContext:
+      scope: token
+  - key: empty
+    emptySecret: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: PartialKMSVaultSecret
+metadata:
+  name: shared
+spec:
+  secrets:
+  - key: shared
+    encryptedSecret: ` + encoded("alias/new:shared") + `
+`,
+			// The partial is decrypted with the secretContext of the KMSVaultSecret that includes it.
+			contexts: []map[string]string{{"env": "staging"}, {"scope": "token"}, {"env": "staging"}},
+		},
+		"changed context": {
+			set:    map[string]string{"env": "production"},
+			remove: map[string]bool{"scope": true},
+			rules:  validation.Rules{InjectNamespaceContext: true, InjectNameContext: true},
+			expected: `apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: KMSVaultSecret
+metadata:
+  name: app
+spec:
+  path: secret/app
+  includeSecrets:
+  - shared
+  secretContext:
+    env: production
+  secrets:
+  - key: password
+    encryptedSecret: ` + encoded("alias/new:secret") + ` # keep this comment
+  - key: token
+    encryptedSecret: "` + encoded("alias/new:token") + `"
+    secretContext:
+      env: production
+  - key: empty
+    emptySecret: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: PartialKMSVaultSecret
+metadata:
+  name: shared
+spec:
+  secrets:
+  - key: shared
+    encryptedSecret: ` + encoded("alias/new:shared") + `
+`,
+			contexts: []map[string]string{
+				{"env": "production", "kubernetes_namespace": "team-a", "kubernetes_name": "app"},
+				{"env": "production", "kubernetes_namespace": "team-a", "kubernetes_name": "app"},
+				// The partial is bound to the name of the KMSVaultSecret that includes it.
+				{"env": "production", "kubernetes_namespace": "team-a", "kubernetes_name": "app"},
+			},
+		},
+	} {
+		svc := &reencryptKMS{}
+		r := testReencrypter(t, svc)
+		r.rules = tc.rules
+		for k, v := range tc.set {
+			r.set[k] = v
+		}
+		for k := range tc.remove {
+			r.remove[k] = true
+		}
+		documents, err := readDocuments([]byte(reencryptManifests), "team-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.secrets = []*kmsvaultv1alpha1.KMSVaultSecret{documents[0].obj.(*kmsvaultv1alpha1.KMSVaultSecret)}
+		src := newSource([]byte(reencryptManifests))
+		edits := []textEdit{}
+		count := 0
+		for _, d := range documents {
+			e, n, err := r.objectEdits(src, d)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			edits = append(edits, e...)
+			count += n
+		}
+		if count != 3 {
+			t.Errorf("%s: expected 3 values to be re-encrypted, got %d", name, count)
+		}
+		if out := string(src.apply(edits)); out != tc.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, tc.expected, out)
+		}
+		if len(svc.inputs) != len(tc.contexts) {
+			t.Fatalf("%s: expected %d calls to ReEncrypt, got %d", name, len(tc.contexts), len(svc.inputs))
+		}
+		for i, input := range svc.inputs {
+			if aws.StringValue(input.DestinationKeyId) != "alias/new" {
+				t.Errorf("%s: unexpected destination key %s", name, aws.StringValue(input.DestinationKeyId))
+			}
+			if context := aws.StringValueMap(input.DestinationEncryptionContext); !reflect.DeepEqual(context, tc.contexts[i]) {
+				t.Errorf("%s: expected the destination context of value %d to be %v, got %v", name, i, tc.contexts[i], context)
+			}
+		}
+	}
+}
+
+func TestUpdatedContext(t *testing.T) {
+	r := &reencrypter{set: map[string]string{"env": "production"}, remove: map[string]bool{"scope": true}}
+	original := map[string]string{"env": "staging", "scope": "token", "app": "web"}
+	updated := r.updatedContext(original)
+	expected := map[string]string{"env": "production", "app": "web"}
+	if !reflect.DeepEqual(updated, expected) {
+		t.Errorf("Expected %v, got %v", expected, updated)
+	}
+	if original["env"] != "staging" || original["scope"] != "token" {
+		t.Errorf("Expected the original context to be left as is, got %v", original)
+	}
+	if !r.changesContext() || (&reencrypter{}).changesContext() {
+		t.Error("Expected only a reencrypter with -context or -remove-context to change contexts")
+	}
+}
+
+func TestObjectEditsEnvelope(t *testing.T) {
+	envelope, err := json.Marshal(kmsutil.Envelope{Key: []byte("data-key"), Nonce: []byte("nonce"), Ciphertext: []byte("bundle")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := `apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: KMSVaultSecret
+metadata:
+  name: app
+spec:
+  path: secret/app
+  secrets:
+  - key: app
+    encryptedSecret: ` + base64.StdEncoding.EncodeToString(envelope) + `
+    bundle:
+      format: dotenv
+      envelope: true
+`
+	svc := &reencryptKMS{}
+	r := testReencrypter(t, svc)
+	documents, err := readDocuments([]byte(content), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := newSource([]byte(content))
+	edits, count, err := r.objectEdits(src, documents[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || len(svc.inputs) != 1 || string(svc.inputs[0].CiphertextBlob) != "data-key" {
+		t.Fatalf("Expected only the data key to be re-encrypted, got %d values and %v", count, svc.inputs)
+	}
+	rewritten, err := readDocuments(src.apply(edits), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(rewritten[0].obj.(*kmsvaultv1alpha1.KMSVaultSecret).Spec.Secrets[0].EncryptedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reencrypted, err := kmsutil.ParseEnvelope(decoded)
+	if err != nil {
+		t.Fatalf("Expected the value to still be an envelope: %v", err)
+	}
+	if string(reencrypted.Key) != "alias/new:data-key" || string(reencrypted.Nonce) != "nonce" || string(reencrypted.Ciphertext) != "bundle" {
+		t.Errorf("Expected only the key of the envelope to change, got %+v", reencrypted)
+	}
+}
+
+func TestObjectEditsPartialContext(t *testing.T) {
+	content := `apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: KMSVaultSecret
+metadata:
+  name: app
+spec:
+  path: secret/app
+  includeSecrets:
+  - shared
+  secretContext:
+    env: staging
+  secrets:
+  - key: token
+    encryptedSecret: dG9rZW4=
+    secretContext:
+      scope: token
+---
+apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: PartialKMSVaultSecret
+metadata:
+  name: shared
+spec:
+  secretContext:
+    env: ignored
+  secrets:
+  - key: shared
+    encryptedSecret: c2hhcmVk
+`
+	svc := &reencryptKMS{}
+	r := testReencrypter(t, svc)
+	r.set["env"] = "production"
+	documents, err := readDocuments([]byte(content), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.secrets = []*kmsvaultv1alpha1.KMSVaultSecret{documents[0].obj.(*kmsvaultv1alpha1.KMSVaultSecret)}
+	src := newSource([]byte(content))
+	edits := []textEdit{}
+	for _, d := range documents {
+		e, _, err := r.objectEdits(src, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edits = append(edits, e...)
+	}
+	if len(svc.inputs) != 2 {
+		t.Fatalf("Expected 2 calls to ReEncrypt, got %d", len(svc.inputs))
+	}
+	partial := svc.inputs[1]
+	if context := aws.StringValueMap(partial.SourceEncryptionContext); !reflect.DeepEqual(context, map[string]string{"env": "staging"}) {
+		t.Errorf("Expected the partial to be decrypted with the context of the KMSVaultSecret that includes it, got %v", context)
+	}
+	if context := aws.StringValueMap(partial.DestinationEncryptionContext); !reflect.DeepEqual(context, map[string]string{"env": "production"}) {
+		t.Errorf("Expected the partial to be re-encrypted with the updated context of the KMSVaultSecret that includes it, got %v", context)
+	}
+	rewritten, err := readDocuments(src.apply(edits), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context := rewritten[0].obj.(*kmsvaultv1alpha1.KMSVaultSecret).Spec.SecretContext; !reflect.DeepEqual(context, map[string]string{"env": "production"}) {
+		t.Errorf("Expected the secretContext of the KMSVaultSecret to be updated, got %v", context)
+	}
+	if context := rewritten[1].obj.(*kmsvaultv1alpha1.PartialKMSVaultSecret).Spec.SecretContext; !reflect.DeepEqual(context, map[string]string{"env": "ignored"}) {
+		t.Errorf("Expected the ignored secretContext of the partial to be left as is, got %v", context)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// plaintextEntry is a key and its value, in the order they're found in the plaintext file.
+type plaintextEntry struct {
+	key   string
+	value string
+}
+
+// seal encrypts every value of a plaintext file and prints a KMSVaultSecret or PartialKMSVaultSecret manifest with
+// them.
+func seal(args []string) error {
+	fl := flag.NewFlagSet("seal", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintf(fl.Output(), "Usage: kmsvault seal -key-id <key> -name <name> [flags] <file>\n\nThe file is a .env file if its extension is .env, or a YAML map otherwise. Use - to read YAML from stdin.\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	e := &encryptionFlags{}
+	e.register(fl)
+	kind := fl.String("kind", "KMSVaultSecret", "Kind of the manifest, KMSVaultSecret or PartialKMSVaultSecret")
+	path := fl.String("path", "", "Vault path of the KMSVaultSecret")
+	engineVersion := fl.String("engine-version", "", "KV engine version of the KMSVaultSecret, v1 or v2")
+	includedBy := fl.String("included-by", "", "Name of the KMSVaultSecret that includes the PartialKMSVaultSecret, which is the name bound by -bind-name")
+	fl.Parse(args)
+
+	if len(e.name) == 0 {
+		return errors.New("-name is required")
+	}
+	manifestName := e.name
+	switch *kind {
+	case "KMSVaultSecret":
+		if len(*path) == 0 {
+			return errors.New("-path is required for a KMSVaultSecret")
+		}
+		if *engineVersion != "" && *engineVersion != "v1" && *engineVersion != "v2" {
+			return fmt.Errorf("Invalid engine version %s", *engineVersion)
+		}
+	case "PartialKMSVaultSecret":
+		if e.bindName && len(*includedBy) == 0 {
+			return errors.New("-bind-name requires -included-by for a PartialKMSVaultSecret")
+		}
+		e.name = *includedBy
+	default:
+		return fmt.Errorf("Invalid kind %s", *kind)
+	}
+	encryptionContext, err := e.encryptionContext()
+	if err != nil {
+		return err
+	}
+	if fl.NArg() != 1 {
+		fl.Usage()
+		os.Exit(2)
+	}
+	entries, err := readPlaintext(fl.Arg(0))
+	if err != nil {
+		return err
+	}
+	svc, err := e.kmsClient()
+	if err != nil {
+		return err
+	}
+	secrets := []kmsvaultv1alpha1.Secret{}
+	for _, entry := range entries {
+		if len(entry.value) == 0 {
+			secrets = append(secrets, kmsvaultv1alpha1.Secret{Key: entry.key, EmptySecret: true})
+			continue
+		}
+		ciphertext, err := encryptValue(svc, e.keyID, []byte(entry.value), encryptionContext)
+		if err != nil {
+			return fmt.Errorf("Error encrypting %s: %w", entry.key, err)
+		}
+		secrets = append(secrets, kmsvaultv1alpha1.Secret{Key: entry.key, EncryptedSecret: ciphertext})
+	}
+
+	metadata := map[string]interface{}{"name": manifestName}
+	if len(e.namespace) > 0 {
+		metadata["namespace"] = e.namespace
+	}
+	spec := map[string]interface{}{"secrets": secrets}
+	if len(encryptionContext) > 0 {
+		spec["secretContext"] = encryptionContext
+	}
+	if *kind == "KMSVaultSecret" {
+		spec["path"] = *path
+		if len(*engineVersion) > 0 {
+			spec["kvSettings"] = kmsvaultv1alpha1.KVSettings{EngineVersion: *engineVersion}
+		}
+		if e.clientConfig() != (kmsutil.ClientConfig{}) {
+			spec["kms"] = kmsvaultv1alpha1.KMSSettings{Region: e.region, RoleARN: e.roleARN, ExternalID: e.externalID}
+		}
+	}
+	out, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": kmsvaultv1alpha1.GroupVersion.String(),
+		"kind":       *kind,
+		"metadata":   metadata,
+		"spec":       spec,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// readPlaintext reads the entries of a .env file or a flat YAML map.
+func readPlaintext(file string) ([]plaintextEntry, error) {
+	var content []byte
+	var err error
+	if file == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(file) == ".env" {
+		return parseDotenv(content)
+	}
+	return parseYAMLMap(content)
+}
+
+func parseYAMLMap(content []byte) ([]plaintextEntry, error) {
+	doc := &yamlv3.Node{}
+	err := yamlv3.Unmarshal(content, doc)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return []plaintextEntry{}, nil
+	}
+	m := doc.Content[0]
+	if m.Kind != yamlv3.MappingNode {
+		return nil, errors.New("The plaintext file must be a YAML map")
+	}
+	entries := []plaintextEntry{}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		if v.Kind != yamlv3.ScalarNode {
+			return nil, fmt.Errorf("The value of %s must be a string", k.Value)
+		}
+		value := v.Value
+		if v.Tag == "!!null" {
+			value = ""
+		}
+		entries = append(entries, plaintextEntry{key: k.Value, value: value})
+	}
+	return entries, nil
+}
+
+func parseDotenv(content []byte) ([]plaintextEntry, error) {
+	parsed, err := format.ParseDotenv(content)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]plaintextEntry, len(parsed))
+	for i, e := range parsed {
+		entries[i] = plaintextEntry{key: e.Key, value: e.Value}
+	}
+	return entries, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAMLMap(t *testing.T) {
+	entries, err := parseYAMLMap([]byte("USER: app\nPORT: 5432\nEMPTY:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []plaintextEntry{{key: "USER", value: "app"}, {key: "PORT", value: "5432"}, {key: "EMPTY", value: ""}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+	entries, err = parseYAMLMap([]byte(""))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries for an empty file, got %v (%v)", entries, err)
+	}
+	for _, content := range []string{"- app\n", "USER:\n  name: app\n", "USER: [app]\n"} {
+		if _, err := parseYAMLMap([]byte(content)); err == nil {
+			t.Errorf("Expected an error parsing %q", content)
+		}
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	entries, err := parseDotenv([]byte("# comment\nUSER=app\nPASSWORD=\"s3cr3t\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []plaintextEntry{{key: "USER", value: "app"}, {key: "PASSWORD", value: "s3cr3t"}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	"github.com/patoarvizu/kms-vault-operator/pkg/validation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// manifest is an object read from a manifest file.
+type manifest struct {
+	file string
+	obj  client.Object
+}
+
+// validate runs the checks of the validating webhook on the KMSVaultSecrets and PartialKMSVaultSecrets in the given
+// files. Included partials, KMSVaultNamespaceConfigs, KMSVaultPolicies and Namespaces are looked up in the same files
+// instead of a cluster.
+func validate(args []string) error {
+	fl := flag.NewFlagSet("validate", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintf(fl.Output(), "Usage: kmsvault validate [flags] <file>...\n\nUse - to read manifests from stdin.\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	namespace := fl.String("namespace", "default", "Namespace of the objects that don't set one")
+	validationMode := fl.String("validation-mode", validation.DecryptMode, "How ciphertexts are validated, either 'decrypt' (with kms:Decrypt) or 'structural' (only checking their structure and KMS key with kms:ReEncrypt, without decrypting them)")
+	allowedKMSKeys := fl.String("allowed-kms-keys", "", "Comma-separated list of KMS key ids, ARNs or aliases that secrets are allowed to be encrypted with, empty means any key")
+	pathPrefixTemplate := fl.String("path-prefix-template", "", "Template of the Vault path that every secret path must be under, e.g. 'secret/data/{{ .Namespace }}', empty means any path")
+	requiredContextKeys := fl.String("required-context-keys", "", "Comma-separated list of keys that must be in the encryption context of every secret, as key or key=value, where the value can be a template like {{ .Namespace }}")
+	injectNamespaceContext := fl.Bool("inject-namespace-context", false, "Add kubernetes_namespace=<namespace> to the encryption context of every secret")
+	injectNameContext := fl.Bool("inject-name-context", false, "Also add kubernetes_name=<name> to the encryption context of every secret, requires -inject-namespace-context")
+	fl.Parse(args)
+
+	if *validationMode != validation.DecryptMode && *validationMode != validation.StructuralMode {
+		return fmt.Errorf("Invalid validation mode %s", *validationMode)
+	}
+	if fl.NArg() == 0 {
+		fl.Usage()
+		os.Exit(2)
+	}
+	manifests := []manifest{}
+	for _, file := range fl.Args() {
+		m, err := readManifests(file, *namespace)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %w", file, err)
+		}
+		manifests = append(manifests, m...)
+	}
+	k8sClient, err := manifestClient(manifests)
+	if err != nil {
+		return err
+	}
+	kmsClients, err := kmsutil.NewClientCache()
+	if err != nil {
+		return err
+	}
+	validator := &validation.Validator{
+		Client:     k8sClient,
+		KMSClients: kmsClients.Client,
+		Rules: validation.Rules{
+			Mode:                   *validationMode,
+			AllowedKeys:            []kmsutil.KeyAllowlist{kmsutil.ParseKeyAllowlist(*allowedKMSKeys)},
+			RequiredContext:        policy.ParseContextRequirements(strings.Split(*requiredContextKeys, ",")),
+			InjectNamespaceContext: *injectNamespaceContext,
+			InjectNameContext:      *injectNameContext,
+		},
+		PathPrefixTemplate: *pathPrefixTemplate,
+	}
+
+	ctx := context.Background()
+	invalid := 0
+	for _, m := range manifests {
+		var reason string
+		switch obj := m.obj.(type) {
+		case *kmsvaultv1alpha1.KMSVaultSecret:
+			reason, err = validator.KMSVaultSecret(ctx, obj)
+		case *kmsvaultv1alpha1.PartialKMSVaultSecret:
+			var includedBy []kmsvaultv1alpha1.KMSVaultSecret
+			includedBy, err = validator.IncludingSecrets(ctx, obj)
+			if err == nil {
+				reason, err = validator.PartialKMSVaultSecret(ctx, obj, includedBy)
+			}
+		default:
+			continue
+		}
+		kind := m.obj.GetObjectKind().GroupVersionKind().Kind
+		if err != nil {
+			return fmt.Errorf("Error validating %s %s/%s in %s: %w", kind, m.obj.GetNamespace(), m.obj.GetName(), m.file, err)
+		}
+		if len(reason) > 0 {
+			invalid++
+			fmt.Printf("%s: %s %s/%s is not valid: %s\n", m.file, kind, m.obj.GetNamespace(), m.obj.GetName(), reason)
+			continue
+		}
+		fmt.Printf("%s: %s %s/%s is valid\n", m.file, kind, m.obj.GetNamespace(), m.obj.GetName())
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d objects are not valid", invalid)
+	}
+	return nil
+}
+
+// readManifests reads the objects relevant to validation from a file with one or more YAML or JSON documents,
+// ignoring the rest.
+func readManifests(file string, defaultNamespace string) ([]manifest, error) {
+	var r io.Reader
+	if file == "-" {
+		r = os.Stdin
+	} else {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(content)
+	}
+	manifests := []manifest{}
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		typeMeta := &metav1.TypeMeta{}
+		err = yaml.Unmarshal(doc, typeMeta)
+		if err != nil {
+			return nil, err
+		}
+		var obj client.Object
+		switch typeMeta.Kind {
+		case "KMSVaultSecret":
+			obj = &kmsvaultv1alpha1.KMSVaultSecret{}
+		case "PartialKMSVaultSecret":
+			obj = &kmsvaultv1alpha1.PartialKMSVaultSecret{}
+		case "KMSVaultNamespaceConfig":
+			obj = &kmsvaultv1alpha1.KMSVaultNamespaceConfig{}
+		case "KMSVaultPolicy":
+			obj = &kmsvaultv1alpha1.KMSVaultPolicy{}
+		case "Namespace":
+			obj = &corev1.Namespace{}
+		default:
+			continue
+		}
+		err = yaml.Unmarshal(doc, obj)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding %s: %w", typeMeta.Kind, err)
+		}
+		if len(obj.GetName()) == 0 {
+			return nil, fmt.Errorf("%s without a name", typeMeta.Kind)
+		}
+		clusterScoped := typeMeta.Kind == "Namespace" || typeMeta.Kind == "KMSVaultPolicy"
+		if !clusterScoped && len(obj.GetNamespace()) == 0 {
+			obj.SetNamespace(defaultNamespace)
+		}
+		manifests = append(manifests, manifest{file: file, obj: obj})
+	}
+}
+
+// manifestClient returns a client that serves the objects in manifests. Namespaces that the objects are in but that
+// are not in the manifests are added without labels.
+func manifestClient(manifests []manifest) (client.Client, error) {
+	scheme := runtime.NewScheme()
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+	err = kmsvaultv1alpha1.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+	objects := []client.Object{}
+	seen := map[string]bool{}
+	namespaces := map[string]bool{}
+	for _, m := range manifests {
+		key := m.obj.GetObjectKind().GroupVersionKind().Kind + "/" + m.obj.GetNamespace() + "/" + m.obj.GetName()
+		if seen[key] {
+			return nil, errors.New("Duplicate " + key)
+		}
+		seen[key] = true
+		if ns, ok := m.obj.(*corev1.Namespace); ok {
+			namespaces[ns.Name] = true
+		}
+		objects = append(objects, m.obj.DeepCopyObject().(client.Object))
+	}
+	for _, m := range manifests {
+		ns := m.obj.GetNamespace()
+		if len(ns) > 0 && !namespaces[ns] {
+			namespaces[ns] = true
+			objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+		}
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const testManifests = `apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: KMSVaultSecret
+metadata:
+  name: app
+spec:
+  path: secret/app
+  includeSecrets:
+  - shared
+---
+apiVersion: k8s.patoarvizu.dev/v1alpha1
+kind: PartialKMSVaultSecret
+metadata:
+  name: shared
+  namespace: team-a
+spec:
+  secrets: []
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+  labels:
+    team: a
+`
+
+func writeManifests(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "manifests.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReadManifests(t *testing.T) {
+	manifests, err := readManifests(writeManifests(t, testManifests), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 3 {
+		t.Fatalf("Expected 3 manifests, got %d", len(manifests))
+	}
+	secret, ok := manifests[0].obj.(*kmsvaultv1alpha1.KMSVaultSecret)
+	if !ok || secret.Namespace != "default" || secret.Spec.Path != "secret/app" {
+		t.Errorf("Expected the KMSVaultSecret in the default namespace, got %+v", manifests[0].obj)
+	}
+	if manifests[1].obj.GetNamespace() != "team-a" {
+		t.Errorf("Expected the namespace of the partial to be kept, got %s", manifests[1].obj.GetNamespace())
+	}
+	if manifests[2].obj.GetNamespace() != "" {
+		t.Errorf("Expected the Namespace to not be namespaced, got %s", manifests[2].obj.GetNamespace())
+	}
+	_, err = readManifests(writeManifests(t, "apiVersion: k8s.patoarvizu.dev/v1alpha1\nkind: KMSVaultSecret\nmetadata: {}\n"), "default")
+	if err == nil {
+		t.Error("Expected an error reading an object without a name")
+	}
+}
+
+func TestManifestClient(t *testing.T) {
+	manifests, err := readManifests(writeManifests(t, testManifests), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := manifestClient(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := &kmsvaultv1alpha1.PartialKMSVaultSecret{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "team-a", Name: "shared"}, partial); err != nil {
+		t.Errorf("Expected the partial to be served: %v", err)
+	}
+	namespace := &corev1.Namespace{}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "team-a"}, namespace); err != nil || namespace.Labels["team"] != "a" {
+		t.Errorf("Expected the namespace from the manifests, got %+v (%v)", namespace.Labels, err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "default"}, namespace); err != nil {
+		t.Errorf("Expected the namespace of the KMSVaultSecret to be added: %v", err)
+	}
+	_, err = manifestClient(append(manifests, manifests[0]))
+	if err == nil {
+		t.Error("Expected an error for duplicate objects")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/patoarvizu/kms-vault-operator/pkg/logging"
+	whcontext "github.com/slok/kubewebhook/pkg/webhook/context"
+)
+
+// auditIDHeader is the header that holds the audit ID of a request to the API server.
+const auditIDHeader = "Audit-Id"
+
+type auditIDKey struct{}
+
+// kubewebhookLogger adapts a logr.Logger to the logger interface of kubewebhook.
+type kubewebhookLogger struct {
+	logr.Logger
+}
+
+func (l kubewebhookLogger) Infof(format string, args ...interface{}) {
+	l.Info(fmt.Sprintf(format, args...))
+}
+
+func (l kubewebhookLogger) Warningf(format string, args ...interface{}) {
+	l.Info(fmt.Sprintf(format, args...))
+}
+
+func (l kubewebhookLogger) Errorf(format string, args ...interface{}) {
+	l.Error(nil, fmt.Sprintf(format, args...))
+}
+
+func (l kubewebhookLogger) Debugf(format string, args ...interface{}) {
+	l.V(1).Info(fmt.Sprintf(format, args...))
+}
+
+// withAuditID keeps the audit ID of incoming requests, if they have one, so that admissionLogger can log it.
+func withAuditID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auditID := r.Header.Get(auditIDHeader); len(auditID) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), auditIDKey{}, auditID))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// admissionLogger returns the webhook logger with the details of the admission request in ctx, and its audit ID if
+// it has one.
+func admissionLogger(ctx context.Context) logr.Logger {
+	l := webhookLog
+	if ar := whcontext.GetAdmissionRequest(ctx); ar != nil {
+		l = l.WithValues(
+			logging.AdmissionUIDKey, string(ar.UID),
+			logging.OperationKey, string(ar.Operation),
+			logging.KindKey, ar.Kind.Kind,
+			logging.NamespaceKey, ar.Namespace,
+			logging.NameKey, ar.Name,
+		)
+	}
+	if auditID, ok := ctx.Value(auditIDKey{}).(string); ok {
+		l = l.WithValues(logging.AuditIDKey, auditID)
+	}
+	return l
+}
+
+// logResult logs the result of validating the object of the admission request in ctx, which was rejected for reason
+// if it's not empty.
+func logResult(ctx context.Context, reason string, err error) {
+	l := admissionLogger(ctx)
+	switch {
+	case err != nil:
+		l.Error(err, "Error validating object")
+	case len(reason) > 0:
+		l.Info("Object rejected", "reason", reason)
+	default:
+		l.V(1).Info("Object accepted")
+	}
+}
@@ -3,125 +3,243 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/go-logr/logr"
+	vaultapi "github.com/hashicorp/vault/api"
 	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/logging"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
+	"github.com/patoarvizu/kms-vault-operator/pkg/validation"
 	"github.com/radovskyb/watcher"
 	whhttp "github.com/slok/kubewebhook/pkg/http"
 	"github.com/slok/kubewebhook/pkg/log"
+	whcontext "github.com/slok/kubewebhook/pkg/webhook/context"
+	mutatingwh "github.com/slok/kubewebhook/pkg/webhook/mutating"
 	validatingwh "github.com/slok/kubewebhook/pkg/webhook/validating"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/slok/kubewebhook/pkg/observability/metrics"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type webhookCfg struct {
-	certFile    string
-	keyFile     string
-	addr        string
-	metricsAddr string
+	certFile               string
+	keyFile                string
+	addr                   string
+	metricsAddr            string
+	allowedKMSKeys         string
+	pathPrefixTemplate     string
+	addDeleteFinalizer     bool
+	defaultEngineVersion   string
+	detectEngineVersion    bool
+	vaultAuthMethod        string
+	defaultLabels          string
+	validationMode         string
+	requiredContextKeys    string
+	injectNamespaceContext bool
+	injectNameContext      bool
+	otelEndpoint           string
+	otelInsecure           bool
+	logFormat              string
+	logLevel               string
 }
 
 var cfg = &webhookCfg{}
+var webhookLog logr.Logger = ctrl.Log.WithName("webhook")
+var logger log.Logger = kubewebhookLogger{webhookLog}
 var cachedCertificate tls.Certificate
+var kmsClients *kmsutil.ClientCache
+var k8sClient client.Client
+var validator *validation.Validator
 
-func validate(_ context.Context, obj metav1.Object) (bool, validatingwh.ValidatorResult, error) {
-	awsSession, err := session.NewSession()
+func validate(ctx context.Context, obj metav1.Object) (bool, validatingwh.ValidatorResult, error) {
+	traceAdmission(ctx)
+	// Webhook configurations created before partials had their own path send them here too, but they're decoded
+	// as KMSVaultSecrets.
+	if ar := whcontext.GetAdmissionRequest(ctx); ar != nil && ar.Kind.Kind == "PartialKMSVaultSecret" {
+		raw := ar.Object.Raw
+		if ar.Operation == admissionv1beta1.Delete {
+			raw = ar.OldObject.Raw
+		}
+		partial := &kmsvaultv1alpha1.PartialKMSVaultSecret{}
+		err := json.Unmarshal(raw, partial)
+		if err != nil {
+			return false, validatingwh.ValidatorResult{}, err
+		}
+		return validatePartial(ctx, partial)
+	}
+	setNamespace(ctx, obj)
+	secret, ok := obj.(*kmsvaultv1alpha1.KMSVaultSecret)
+	if !ok {
+		return false, validatingwh.ValidatorResult{}, fmt.Errorf("Object is not a KMSVaultSecret")
+	}
+	reason, err := validator.KMSVaultSecret(ctx, secret)
+	logResult(ctx, reason, err)
+	return false, result(reason), err
+}
+
+// validatePartial checks that the secrets of a PartialKMSVaultSecret can be decrypted with the KMS settings of every
+// KMSVaultSecret that includes it (or the default ones if none does), and prevents deleting it while it's included.
+func validatePartial(ctx context.Context, obj metav1.Object) (bool, validatingwh.ValidatorResult, error) {
+	traceAdmission(ctx)
+	setNamespace(ctx, obj)
+	partial, ok := obj.(*kmsvaultv1alpha1.PartialKMSVaultSecret)
+	if !ok {
+		return false, validatingwh.ValidatorResult{}, fmt.Errorf("Object is not a PartialKMSVaultSecret")
+	}
+	includedBy, err := validator.IncludingSecrets(ctx, partial)
 	if err != nil {
 		return false, validatingwh.ValidatorResult{}, err
 	}
-	svc := kms.New(awsSession)
-	secret, ok := obj.(*kmsvaultv1alpha1.KMSVaultSecret)
-	if ok {
-		for _, s := range secret.Spec.Secrets {
-			if s.EmptySecret {
-				continue
-			}
-			decoded, err := base64.StdEncoding.DecodeString(s.EncryptedSecret)
-			if err != nil {
-				return false, validatingwh.ValidatorResult{
-					Valid:   false,
-					Message: fmt.Sprintf("Error decoding key %s in KMSVaultSecret %s", s.Key, secret.ObjectMeta.Name),
-				}, nil
-			}
-			_, err = svc.Decrypt(&kms.DecryptInput{CiphertextBlob: decoded, EncryptionContext: getApplicableContext(s.SecretContext, secret.Spec.SecretContext)})
-			if err != nil {
-				return false, validatingwh.ValidatorResult{
-					Valid:   false,
-					Message: fmt.Sprintf("Error decrypting key %s in KMSVaultSecret %s", s.Key, secret.ObjectMeta.Name),
-				}, nil
-			}
-		}
-	} else {
-		partial, ok := obj.(*kmsvaultv1alpha1.PartialKMSVaultSecret)
-		if !ok {
-			return false, validatingwh.ValidatorResult{}, fmt.Errorf("Object is neither a KMSVaultSecret or a PartialKMSVaultSecret")
+	if ar := whcontext.GetAdmissionRequest(ctx); ar != nil && ar.Operation == admissionv1beta1.Delete {
+		if len(includedBy) == 0 {
+			return false, validatingwh.ValidatorResult{Valid: true}, nil
 		}
-		for _, s := range partial.Spec.Secrets {
-			if s.EmptySecret {
-				continue
-			}
-			decoded, err := base64.StdEncoding.DecodeString(s.EncryptedSecret)
-			if err != nil {
-				return false, validatingwh.ValidatorResult{
-					Valid:   false,
-					Message: fmt.Sprintf("Error decoding key %s in KMSVaultSecret %s", s.Key, partial.ObjectMeta.Name),
-				}, nil
-			}
-			_, err = svc.Decrypt(&kms.DecryptInput{CiphertextBlob: decoded, EncryptionContext: getApplicableContext(s.SecretContext, partial.Spec.SecretContext)})
-			if err != nil {
-				return false, validatingwh.ValidatorResult{
-					Valid:   false,
-					Message: fmt.Sprintf("Error decrypting key %s in KMSVaultSecret %s", s.Key, partial.ObjectMeta.Name),
-				}, nil
-			}
+		names := []string{}
+		for _, s := range includedBy {
+			names = append(names, s.Name)
 		}
+		reason := fmt.Sprintf("PartialKMSVaultSecret %s can't be deleted because it's included by KMSVaultSecrets %s", partial.ObjectMeta.Name, strings.Join(names, ", "))
+		logResult(ctx, reason, nil)
+		return false, result(reason), nil
 	}
-	return false, validatingwh.ValidatorResult{Valid: true}, nil
+	reason, err := validator.PartialKMSVaultSecret(ctx, partial, includedBy)
+	logResult(ctx, reason, err)
+	return false, result(reason), err
 }
 
-func getApplicableContext(lowerContext map[string]string, higherContext map[string]string) map[string]*string {
-	if len(lowerContext) > 0 {
-		return convertContextMap(lowerContext)
-	} else {
-		return convertContextMap(higherContext)
+// setNamespace sets the namespace of the request on obj, since it's not always set on the object of a create request.
+func setNamespace(ctx context.Context, obj metav1.Object) {
+	if ar := whcontext.GetAdmissionRequest(ctx); ar != nil && len(obj.GetNamespace()) == 0 {
+		obj.SetNamespace(ar.Namespace)
 	}
 }
 
-func convertContextMap(context map[string]string) map[string]*string {
-	m := make(map[string]*string)
-	for k, v := range context {
-		m[k] = &v
+// traceAdmission adds the details of the admission request in ctx to the span of the request, so it can be correlated
+// with the API server audit log.
+func traceAdmission(ctx context.Context) {
+	ar := whcontext.GetAdmissionRequest(ctx)
+	if ar == nil {
+		return
 	}
-	return m
+	trace.SpanFromContext(ctx).SetAttributes(
+		tracing.AdmissionUIDKey.String(string(ar.UID)),
+		tracing.AdmissionOperationKey.String(string(ar.Operation)),
+		tracing.KindKey.String(ar.Kind.Kind),
+		tracing.NamespaceKey.String(ar.Namespace),
+		tracing.NameKey.String(ar.Name),
+	)
 }
 
-func main() {
-	logger := &log.Std{}
-	logger.Infof("Starting webhook!")
+// result returns the result of a validation that failed for reason, or succeeded if it's empty.
+func result(reason string) validatingwh.ValidatorResult {
+	if len(reason) > 0 {
+		return validatingwh.ValidatorResult{Valid: false, Message: reason}
+	}
+	return validatingwh.ValidatorResult{Valid: true}
+}
 
+func main() {
 	fl := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	fl.StringVar(&cfg.certFile, "tls-cert-file", "", "TLS certificate file")
 	fl.StringVar(&cfg.keyFile, "tls-key-file", "", "TLS key file")
 	fl.StringVar(&cfg.addr, "listen-addr", ":4443", "The address to start the server")
 	fl.StringVar(&cfg.metricsAddr, "metrics-addr", ":8081", "The address where the Prometheus-style metrics are published")
+	fl.StringVar(&cfg.allowedKMSKeys, "allowed-kms-keys", "", "Comma-separated list of KMS key ids, ARNs or aliases that secrets are allowed to be encrypted with, empty means any key")
+	fl.StringVar(&cfg.pathPrefixTemplate, "path-prefix-template", "", "Template of the Vault path that every secret path must be under, e.g. 'secret/data/{{ .Namespace }}', empty means any path")
+	fl.BoolVar(&cfg.addDeleteFinalizer, "add-delete-finalizer", false, "Add the delete.k8s.patoarvizu.dev finalizer to KMSVaultSecrets that don't have it")
+	fl.StringVar(&cfg.defaultEngineVersion, "default-engine-version", "", "KV engine version to set on KMSVaultSecrets that don't set one, if it can't be detected")
+	fl.BoolVar(&cfg.detectEngineVersion, "detect-engine-version", false, "Detect the KV engine version of KMSVaultSecrets that don't set one from the mount of their path in Vault")
+	fl.StringVar(&cfg.vaultAuthMethod, "vault-authentication-method", "token", "Method used to authenticate with Vault to detect KV engine versions, the same as the --vault-authentication-method of the operator")
+	fl.StringVar(&cfg.defaultLabels, "default-labels", "", "Comma-separated list of key=value labels to add to KMSVaultSecrets that don't set them")
+	fl.StringVar(&cfg.validationMode, "validation-mode", validation.DecryptMode, "How ciphertexts are validated, either 'decrypt' (with kms:Decrypt) or 'structural' (only checking their structure and KMS key with kms:ReEncrypt, without decrypting them)")
+	fl.StringVar(&cfg.requiredContextKeys, "required-context-keys", "", "Comma-separated list of keys that must be in the encryption context of every secret, as key or key=value, where the value can be a template like {{ .Namespace }}")
+	fl.BoolVar(&cfg.injectNamespaceContext, "inject-namespace-context", false, "Add kubernetes_namespace=<namespace> to the encryption context of every secret")
+	fl.BoolVar(&cfg.injectNameContext, "inject-name-context", false, "Also add kubernetes_name=<name> to the encryption context of every secret, requires -inject-namespace-context")
+	fl.StringVar(&cfg.otelEndpoint, "otel-endpoint", "", "Address (host:port) of an OTLP gRPC collector to export traces to, empty disables tracing")
+	fl.BoolVar(&cfg.otelInsecure, "otel-insecure", false, "Connect to -otel-endpoint without TLS")
+
+	fl.StringVar(&cfg.logFormat, "log-format", logging.ConsoleFormat, "Format of the logs, either 'json' or 'console'")
+	fl.StringVar(&cfg.logLevel, "log-level", "info", "Minimum level of the logs, either 'debug', 'info', 'error' or an integer for the verbosity of debug logs")
 
 	fl.Parse(os.Args[1:])
+	l, err := logging.New(os.Stderr, cfg.logFormat, cfg.logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	ctrl.SetLogger(l)
+	logger.Infof("Starting webhook!")
+	if cfg.validationMode != validation.DecryptMode && cfg.validationMode != validation.StructuralMode {
+		logger.Errorf("Invalid validation mode %s", cfg.validationMode)
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.otelEndpoint, cfg.otelInsecure, "kms-vault-webhook")
+	if err != nil {
+		logger.Errorf("Error setting up tracing: %v", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+	kmsClients, err = kmsutil.NewClientCache()
+	if err != nil {
+		logger.Errorf("Error creating AWS session: %v", err)
+		os.Exit(1)
+	}
+	scheme := runtime.NewScheme()
+	err = kmsvaultv1alpha1.AddToScheme(scheme)
+	if err != nil {
+		logger.Errorf("Error setting up scheme: %v", err)
+		os.Exit(1)
+	}
+	k8sConfig, err := ctrl.GetConfig()
+	if err != nil {
+		logger.Errorf("Error getting Kubernetes client configuration: %v", err)
+		os.Exit(1)
+	}
+	k8sClient, err = client.New(k8sConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		logger.Errorf("Error creating Kubernetes client: %v", err)
+		os.Exit(1)
+	}
+	validator = &validation.Validator{
+		Client:     k8sClient,
+		KMSClients: kmsClients.Client,
+		Rules: validation.Rules{
+			Mode:                   cfg.validationMode,
+			AllowedKeys:            []kmsutil.KeyAllowlist{kmsutil.ParseKeyAllowlist(cfg.allowedKMSKeys)},
+			RequiredContext:        policy.ParseContextRequirements(strings.Split(cfg.requiredContextKeys, ",")),
+			InjectNamespaceContext: cfg.injectNamespaceContext,
+			InjectNameContext:      cfg.injectNameContext,
+		},
+		PathPrefixTemplate: cfg.pathPrefixTemplate,
+	}
+	vaultClient, err = vaultapi.NewClient(vaultapi.DefaultConfig())
+	if err != nil {
+		logger.Errorf("Error creating Vault client: %v", err)
+		os.Exit(1)
+	}
 
 	w := watcher.New()
 	defer w.Close()
 	w.SetMaxEvents(1)
 	w.FilterOps(watcher.Write)
-	err := w.Add(cfg.certFile)
+	err = w.Add(cfg.certFile)
 	if err != nil {
 		logger.Errorf("Error: %v", err)
 	}
@@ -150,11 +268,39 @@ func main() {
 	}
 	reg := prometheus.NewRegistry()
 	metricsRec := metrics.NewPrometheus(reg)
+	validation.DecryptMetrics = kmsutil.NewDecryptMetrics("webhook")
+	reg.MustRegister(validation.DecryptMetrics.Collectors()...)
 	wh, err := validatingwh.NewWebhook(vhc, v, nil, metricsRec, logger)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error creating webhook: %s", err)
 		os.Exit(1)
 	}
+	m := mutatingwh.MutatorFunc(mutate)
+
+	mhc := mutatingwh.WebhookConfig{
+		Name: "kms-vault-secret-mutator",
+		Obj:  &kmsvaultv1alpha1.KMSVaultSecret{},
+	}
+	mwh, err := mutatingwh.NewWebhook(mhc, m, nil, metricsRec, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating mutating webhook: %s", err)
+		os.Exit(1)
+	}
+	pv := validatingwh.ValidatorFunc(validatePartial)
+
+	pvhc := validatingwh.WebhookConfig{
+		Name: "partial-kms-vault-secret-validator",
+		Obj:  &kmsvaultv1alpha1.PartialKMSVaultSecret{},
+	}
+	pwh, err := validatingwh.NewWebhook(pvhc, pv, nil, metricsRec, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating partial secrets webhook: %s", err)
+		os.Exit(1)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", withAuditID(tracing.Handler("Admission /", whhttp.MustHandlerFor(wh))))
+	mux.Handle("/partial", withAuditID(tracing.Handler("Admission /partial", whhttp.MustHandlerFor(pwh))))
+	mux.Handle("/mutate", withAuditID(tracing.Handler("Admission /mutate", whhttp.MustHandlerFor(mwh))))
 	webhookError := make(chan error)
 	go func() {
 		err = cacheCertificate(cfg.certFile, cfg.keyFile)
@@ -162,7 +308,7 @@ func main() {
 			logger.Errorf("Error loading certificate: %v", err)
 			os.Exit(1)
 		}
-		server := http.Server{Addr: cfg.addr, Handler: whhttp.MustHandlerFor(wh), TLSConfig: &tls.Config{GetCertificate: getCertificate}}
+		server := http.Server{Addr: cfg.addr, Handler: mux, TLSConfig: &tls.Config{GetCertificate: getCertificate}}
 		webhookError <- server.ListenAndServeTLS(cfg.certFile, cfg.keyFile)
 	}()
 	metricsError := make(chan error)
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/controllers"
+	"github.com/patoarvizu/kms-vault-operator/pkg/logging"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
+	whcontext "github.com/slok/kubewebhook/pkg/webhook/context"
+	"golang.org/x/sync/singleflight"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var vaultClient *vaultapi.Client
+var vaultTokenLock sync.Mutex
+var vaultTokenValidUntil time.Time
+var vaultLogin singleflight.Group
+
+// secretDefaults are the defaults applied by the mutating webhook to a KMSVaultSecret.
+type secretDefaults struct {
+	addDeleteFinalizer  bool
+	engineVersion       string
+	detectEngineVersion bool
+	labels              map[string]string
+}
+
+// mutate applies the defaults of the namespace of obj, or the cluster-wide ones, to a KMSVaultSecret when it's created.
+// Fields that are already set on the object are never overwritten, and objects that are updated are left as they are,
+// so a change to the defaults (or to the mount of a path) doesn't change existing objects.
+func mutate(ctx context.Context, obj metav1.Object) (bool, error) {
+	traceAdmission(ctx)
+	secret, ok := obj.(*kmsvaultv1alpha1.KMSVaultSecret)
+	if !ok || secret.DeletionTimestamp != nil {
+		return false, nil
+	}
+	ar := whcontext.GetAdmissionRequest(ctx)
+	if ar != nil && ar.Operation != admissionv1beta1.Create {
+		return false, nil
+	}
+	if ar != nil && len(secret.Namespace) == 0 {
+		secret.Namespace = ar.Namespace
+	}
+	defaults, err := namespaceDefaults(ctx, secret.Namespace)
+	if err != nil {
+		return false, err
+	}
+	if defaults.addDeleteFinalizer {
+		controllerutil.AddFinalizer(secret, controllers.DeletedFinalizer)
+	}
+	for k, v := range defaults.labels {
+		if secret.Labels == nil {
+			secret.Labels = map[string]string{}
+		}
+		if _, ok := secret.Labels[k]; !ok {
+			secret.Labels[k] = v
+		}
+	}
+	if len(secret.Spec.KVSettings.EngineVersion) == 0 {
+		engineVersion := ""
+		if defaults.detectEngineVersion {
+			engineVersion = detectEngineVersion(ctx, secret)
+		}
+		if len(engineVersion) == 0 {
+			engineVersion = defaults.engineVersion
+		}
+		secret.Spec.KVSettings.EngineVersion = engineVersion
+	}
+	return false, nil
+}
+
+// namespaceDefaults returns the cluster-wide defaults, overridden by the ones set on the KMSVaultNamespaceConfigs in
+// namespace.
+func namespaceDefaults(ctx context.Context, namespace string) (secretDefaults, error) {
+	defaults := secretDefaults{
+		addDeleteFinalizer:  cfg.addDeleteFinalizer,
+		engineVersion:       cfg.defaultEngineVersion,
+		detectEngineVersion: cfg.detectEngineVersion,
+		labels:              parseLabels(cfg.defaultLabels),
+	}
+	namespaceConfigs := &kmsvaultv1alpha1.KMSVaultNamespaceConfigList{}
+	err := k8sClient.List(ctx, namespaceConfigs, client.InNamespace(namespace))
+	if err != nil {
+		return secretDefaults{}, err
+	}
+	for _, c := range namespaceConfigs.Items {
+		d := c.Spec.Defaults
+		if d.AddDeleteFinalizer != nil {
+			defaults.addDeleteFinalizer = *d.AddDeleteFinalizer
+		}
+		if len(d.EngineVersion) > 0 {
+			defaults.engineVersion = string(d.EngineVersion)
+		}
+		if d.DetectEngineVersion != nil {
+			defaults.detectEngineVersion = *d.DetectEngineVersion
+		}
+		for k, v := range d.Labels {
+			defaults.labels[k] = v
+		}
+	}
+	return defaults, nil
+}
+
+// detectEngineVersion looks up the KV engine version of the mount of the path of secret in Vault. It returns an empty
+// string if the path can't be rendered, or the mount can't be read or is not a KV engine.
+func detectEngineVersion(ctx context.Context, secret *kmsvaultv1alpha1.KMSVaultSecret) string {
+	path, err := policy.RenderPath(secret.Spec.Path, secret)
+	if err != nil {
+		return ""
+	}
+	c, err := authenticatedVaultClient(ctx)
+	if err != nil {
+		admissionLogger(ctx).Error(err, "Error authenticating with Vault to detect the KV engine version", logging.PathKey, path)
+		return ""
+	}
+	mount, err := tracing.VaultClient(ctx, c).Logical().Read("sys/internal/ui/mounts/" + path)
+	if err != nil {
+		if responseErr, ok := err.(*vaultapi.ResponseError); ok && responseErr.StatusCode == http.StatusForbidden {
+			forgetVaultToken()
+		}
+		admissionLogger(ctx).Error(err, "Error detecting the KV engine version", logging.PathKey, path)
+		return ""
+	}
+	if mount == nil {
+		return ""
+	}
+	switch mount.Data["type"] {
+	case "kv":
+		options, _ := mount.Data["options"].(map[string]interface{})
+		if options != nil && options["version"] == "2" {
+			return "v2"
+		}
+		return "v1"
+	case "generic":
+		return "v1"
+	default:
+		return ""
+	}
+}
+
+// authenticatedVaultClient returns the Vault client of the webhook, logged in with -vault-authentication-method. The
+// webhook runs with the service account and Vault environment of the operator, so it gets the same token. The token is
+// used until half of its TTL has passed (or for an hour, if it doesn't expire), and concurrent requests that need to
+// log in share a single login.
+func authenticatedVaultClient(ctx context.Context) (*vaultapi.Client, error) {
+	vaultTokenLock.Lock()
+	valid := time.Now().Before(vaultTokenValidUntil)
+	vaultTokenLock.Unlock()
+	if valid {
+		return vaultClient, nil
+	}
+	_, err, _ := vaultLogin.Do("login", func() (interface{}, error) {
+		err := controllers.VaultLogin(cfg.vaultAuthMethod, vaultClient)
+		if err != nil {
+			return nil, err
+		}
+		lookup, err := tracing.VaultClient(ctx, vaultClient).Auth().Token().LookupSelf()
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := lookup.TokenTTL()
+		if err != nil {
+			return nil, err
+		}
+		validFor := ttl / 2
+		if ttl == 0 {
+			validFor = time.Hour
+		}
+		vaultTokenLock.Lock()
+		vaultTokenValidUntil = time.Now().Add(validFor)
+		vaultTokenLock.Unlock()
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vaultClient, nil
+}
+
+// forgetVaultToken makes the next request log in again, e.g. after Vault rejected the token.
+func forgetVaultToken() {
+	vaultTokenLock.Lock()
+	defer vaultTokenLock.Unlock()
+	vaultTokenValidUntil = time.Time{}
+}
+
+// parseLabels parses a comma-separated list of key=value pairs, like the value of the -default-labels flag.
+func parseLabels(labels string) map[string]string {
+	parsed := map[string]string{}
+	for _, l := range strings.Split(labels, ",") {
+		kv := strings.SplitN(strings.TrimSpace(l), "=", 2)
+		if len(kv) == 2 && len(kv[0]) > 0 {
+			parsed[kv[0]] = kv[1]
+		}
+	}
+	return parsed
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/controllers"
+	whcontext "github.com/slok/kubewebhook/pkg/webhook/context"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func fakeK8sClient(t *testing.T, objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := kmsvaultv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func admissionContext(operation admissionv1beta1.Operation) context.Context {
+	return whcontext.SetAdmissionRequest(context.Background(), &admissionv1beta1.AdmissionRequest{Operation: operation, Namespace: "team-a"})
+}
+
+func TestMutate(t *testing.T) {
+	cfg = &webhookCfg{addDeleteFinalizer: true, defaultEngineVersion: "v1", defaultLabels: "team=platform,env=prod"}
+	enabled := false
+	k8sClient = fakeK8sClient(t, &kmsvaultv1alpha1.KMSVaultNamespaceConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "config"},
+		Spec: kmsvaultv1alpha1.KMSVaultNamespaceConfigSpec{
+			Defaults: kmsvaultv1alpha1.KMSVaultSecretDefaults{AddDeleteFinalizer: &enabled, EngineVersion: "v2", Labels: map[string]string{"team": "a"}},
+		},
+	})
+
+	secret := &kmsvaultv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: map[string]string{"env": "dev"}}}
+	_, err := mutate(admissionContext(admissionv1beta1.Create), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Namespace != "team-a" {
+		t.Errorf("Expected the namespace of the request to be used, got %q", secret.Namespace)
+	}
+	if len(secret.Finalizers) != 0 {
+		t.Errorf("Expected the namespace to disable the finalizer, got %v", secret.Finalizers)
+	}
+	if secret.Spec.KVSettings.EngineVersion != "v2" {
+		t.Errorf("Expected the engine version of the namespace, got %q", secret.Spec.KVSettings.EngineVersion)
+	}
+	if expected := map[string]string{"team": "a", "env": "dev"}; !reflect.DeepEqual(secret.Labels, expected) {
+		t.Errorf("Expected labels %v, got %v", expected, secret.Labels)
+	}
+
+	for _, operation := range []admissionv1beta1.Operation{admissionv1beta1.Update, admissionv1beta1.Delete} {
+		secret := &kmsvaultv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "app"}}
+		_, err := mutate(admissionContext(operation), secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(secret.Finalizers) > 0 || len(secret.Labels) > 0 || len(secret.Spec.KVSettings.EngineVersion) > 0 {
+			t.Errorf("Expected a %s not to be mutated, got %+v", operation, secret)
+		}
+	}
+
+	secret = &kmsvaultv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "app"}}
+	_, err = mutate(admissionContext(admissionv1beta1.Create), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !controllerutil.ContainsFinalizer(secret, controllers.DeletedFinalizer) || secret.Spec.KVSettings.EngineVersion != "v1" || secret.Labels["team"] != "platform" {
+		t.Errorf("Expected the cluster-wide defaults in a namespace without a config, got %+v", secret)
+	}
+}
+
+func TestDetectEngineVersion(t *testing.T) {
+	var logins int32
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "operator-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			atomic.AddInt32(&logins, 1)
+			fmt.Fprint(w, `{"data": {"ttl": 3600}}`)
+		case "/v1/sys/internal/ui/mounts/kv/data/app":
+			fmt.Fprint(w, `{"data": {"path": "kv/", "type": "kv", "options": {"version": "2"}}}`)
+		case "/v1/sys/internal/ui/mounts/secret/app":
+			fmt.Fprint(w, `{"data": {"path": "secret/", "type": "kv", "options": null}}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer vault.Close()
+	var err error
+	vaultClient, err = vaultapi.NewClient(&vaultapi.Config{Address: vault.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultClient.SetMaxRetries(0)
+	vaultClient.ClearToken()
+	os.Setenv("VAULT_TOKEN", "operator-token")
+	defer os.Unsetenv("VAULT_TOKEN")
+	cfg = &webhookCfg{vaultAuthMethod: "token"}
+	forgetVaultToken()
+	defer forgetVaultToken()
+
+	for _, tc := range []struct {
+		path     string
+		expected string
+	}{
+		{"kv/data/app", "v2"},
+		{"other/app", ""},
+		{"secret/app", "v1"},
+	} {
+		secret := &kmsvaultv1alpha1.KMSVaultSecret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "app"},
+			Spec:       kmsvaultv1alpha1.KMSVaultSecretSpec{Path: tc.path},
+		}
+		if version := detectEngineVersion(context.Background(), secret); version != tc.expected {
+			t.Errorf("Expected the engine version of %s to be %q, got %q", tc.path, tc.expected, version)
+		}
+	}
+	if logins != 2 {
+		t.Errorf("Expected a login before the first lookup and after the token was rejected, got %d", logins)
+	}
+}
@@ -3,4 +3,21 @@ package controllers
 var (
 	VaultAuthenticationMethod string
 	SyncPeriodSeconds         int
+	MinSyncIntervalSeconds    int
+	MaxSyncIntervalSeconds    int
+	SyncJitterPercent         int
+	RetryBaseDelaySeconds     int
+	RetryMaxDelaySeconds      int
+	MaxConcurrentReconciles   int
+	KMSQPS                    float64
+	KMSBurst                  int
+	PlaintextCacheTTLSeconds  int
+	PlaintextCacheMaxEntries  int
+	AllowedKMSKeys            string
+	PathPrefixTemplate        string
+	RequiredContextKeys       string
+	InjectNamespaceContext    bool
+	InjectNameContext         bool
+	OTelEndpoint              string
+	OTelInsecure              bool
 )
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	PausedAnnotation  string = "kms-vault.patoarvizu.dev/paused"
+	SyncNowAnnotation string = "kms-vault.patoarvizu.dev/sync-now"
+	DryRunAnnotation  string = "kms-vault.patoarvizu.dev/dry-run"
+	PausedCondition   string = "Paused"
+	DryRunCondition   string = "DryRun"
+	PausedReason      string = "Paused"
+	DryRunReason      string = "DryRun"
+	NoChangesReason   string = "NoChanges"
+	ChangesReason     string = "ChangesPending"
+)
+
+// controlAnnotationsChanged triggers a reconcile when the paused or dry-run annotations change, or when the sync-now
+// annotation is set to a new value. Removing the sync-now annotation, which the operator does after syncing, doesn't.
+var controlAnnotationsChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.ObjectOld == nil || e.ObjectNew == nil {
+			return false
+		}
+		oldAnnotations := e.ObjectOld.GetAnnotations()
+		newAnnotations := e.ObjectNew.GetAnnotations()
+		if oldAnnotations[PausedAnnotation] != newAnnotations[PausedAnnotation] || oldAnnotations[DryRunAnnotation] != newAnnotations[DryRunAnnotation] {
+			return true
+		}
+		syncNow := newAnnotations[SyncNowAnnotation]
+		return len(syncNow) > 0 && syncNow != oldAnnotations[SyncNowAnnotation]
+	},
+}
+
+func isPaused(instance *k8sv1alpha1.KMSVaultSecret) bool {
+	return instance.Annotations[PausedAnnotation] == "true"
+}
+
+func isDryRun(instance *k8sv1alpha1.KMSVaultSecret) bool {
+	return instance.Annotations[DryRunAnnotation] == "true"
+}
+
+func syncNowRequested(instance *k8sv1alpha1.KMSVaultSecret) bool {
+	return len(instance.Annotations[SyncNowAnnotation]) > 0
+}
+
+// updateCondition sets the condition of type conditionType on the object status, or removes it if condition is nil,
+// and updates the status if it changed.
+func (r *KMSVaultSecretReconciler) updateCondition(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret, conditionType string, condition *metav1.Condition) {
+	current := instance.Status.DeepCopy()
+	if condition == nil {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, conditionType)
+	} else {
+		condition.Type = conditionType
+		condition.ObservedGeneration = instance.Generation
+		meta.SetStatusCondition(&instance.Status.Conditions, *condition)
+	}
+	if equality.Semantic.DeepEqual(current, &instance.Status) {
+		return
+	}
+	err := r.Client.Status().Update(ctx, instance)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "Error updating status")
+	}
+}
+
+// paused reports that the object is paused, and skips both writing and deleting it until the paused annotation is
+// removed.
+func (r *KMSVaultSecretReconciler) paused(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret) (ctrl.Result, error) {
+	logf.FromContext(ctx).Info("Secret is paused, skipping it")
+	r.updateCondition(ctx, instance, PausedCondition, &metav1.Condition{
+		Status:  metav1.ConditionTrue,
+		Reason:  PausedReason,
+		Message: fmt.Sprintf("Writes and deletes are skipped while the %s annotation is set", PausedAnnotation),
+	})
+	return reconcile.Result{}, nil
+}
+
+// clearSyncNow removes the sync-now annotation from the object named key. It patches a new object instead of the
+// reconciled one, since that one has the secrets of its PartialKMSVaultSecrets merged into its spec.
+func (r *KMSVaultSecretReconciler) clearSyncNow(ctx context.Context, key types.NamespacedName) {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:null}}}`, SyncNowAnnotation))
+	instance := &k8sv1alpha1.KMSVaultSecret{}
+	instance.Namespace = key.Namespace
+	instance.Name = key.Name
+	err := r.Client.Patch(ctx, instance, client.RawPatch(types.MergePatchType, patch))
+	if client.IgnoreNotFound(err) != nil {
+		logf.FromContext(ctx).Error(err, "Error removing the sync-now annotation")
+	}
+}
+
+// dryRun decrypts the secrets of instance and compares them with the ones at path in Vault, and reports the keys that
+// a sync would add, change or remove in an event and the DryRun condition, without writing anything.
+func (r *KMSVaultSecretReconciler) dryRun(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret, writer KVWriter, path string, options decryptOptions) (ctrl.Result, error) {
+	reqLogger := logf.FromContext(ctx)
+	decryptedSecretData, err := decryptSecrets(ctx, instance, options)
+	if err != nil {
+		reqLogger.Error(err, "Error decrypting secrets")
+		return r.syncFailed(ctx, instance, err)
+	}
+	current, err := writer.read(ctx, path, getVaultClient())
+	if err != nil {
+		reqLogger.Error(err, "Error reading secret from Vault")
+		return r.syncFailed(ctx, instance, err)
+	}
+	diff := diffSecrets(current, decryptedSecretData)
+	message := fmt.Sprintf("Dry run, %s at %s", diff, path)
+	reason := ChangesReason
+	if diff.empty() {
+		reason = NoChangesReason
+	}
+	reqLogger.Info("Dry run", "added", diff.added, "changed", diff.changed, "removed", diff.removed)
+	rec.Event(instance, corev1.EventTypeNormal, DryRunReason, message)
+	r.updateCondition(ctx, instance, DryRunCondition, &metav1.Condition{
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+	return nextSync(ctx, instance), nil
+}
+
+// secretDiff holds the keys that writing a secret would add, change or remove. It never holds values.
+type secretDiff struct {
+	added   []string
+	changed []string
+	removed []string
+}
+
+func diffSecrets(current map[string]interface{}, desired map[string]interface{}) secretDiff {
+	diff := secretDiff{}
+	for k, v := range desired {
+		currentValue, ok := current[k]
+		if !ok {
+			diff.added = append(diff.added, k)
+		} else if !reflect.DeepEqual(currentValue, v) {
+			diff.changed = append(diff.changed, k)
+		}
+	}
+	for k := range current {
+		if _, ok := desired[k]; !ok {
+			diff.removed = append(diff.removed, k)
+		}
+	}
+	sort.Strings(diff.added)
+	sort.Strings(diff.changed)
+	sort.Strings(diff.removed)
+	return diff
+}
+
+func (d secretDiff) empty() bool {
+	return len(d.added) == 0 && len(d.changed) == 0 && len(d.removed) == 0
+}
+
+func (d secretDiff) String() string {
+	if d.empty() {
+		return "no changes"
+	}
+	changes := []string{}
+	for _, c := range []struct {
+		verb string
+		keys []string
+	}{{"would add", d.added}, {"would change", d.changed}, {"would remove", d.removed}} {
+		if len(c.keys) > 0 {
+			changes = append(changes, fmt.Sprintf("%s keys %s", c.verb, strings.Join(c.keys, ", ")))
+		}
+	}
+	return strings.Join(changes, ", ")
+}
+
+// readSecret reads the secret at path, which is nil if there's no secret there.
+func readSecret(ctx context.Context, engine string, path string, vaultClient *vaultapi.Client) (*vaultapi.Secret, error) {
+	var secret *vaultapi.Secret
+	err := vaultRequest(ctx, "Vault.Read", "read", engine, path, vaultClient, func(l *vaultapi.Logical) error {
+		var err error
+		secret, err = l.Read(path)
+		return err
+	})
+	return secret, err
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestDiffSecrets(t *testing.T) {
+	current := map[string]interface{}{"unchanged": "a", "changed": "b", "removed": "c"}
+	desired := map[string]interface{}{"unchanged": "a", "changed": "B", "added": "d"}
+	diff := diffSecrets(current, desired)
+	expected := secretDiff{added: []string{"added"}, changed: []string{"changed"}, removed: []string{"removed"}}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diff)
+	}
+	if diff.String() != "would add keys added, would change keys changed, would remove keys removed" {
+		t.Errorf("Unexpected description %q", diff.String())
+	}
+	if d := diffSecrets(current, current); !d.empty() || d.String() != "no changes" {
+		t.Errorf("Expected no changes, got %+v", d)
+	}
+	if d := diffSecrets(nil, desired); len(d.added) != len(desired) {
+		t.Errorf("Expected every key to be added to a missing secret, got %+v", d)
+	}
+}
+
+func TestControlAnnotationsChanged(t *testing.T) {
+	object := func(annotations map[string]string) *k8sv1alpha1.KMSVaultSecret {
+		return &k8sv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+	}
+	for _, tc := range []struct {
+		name     string
+		old      map[string]string
+		new      map[string]string
+		expected bool
+	}{
+		{"paused", nil, map[string]string{PausedAnnotation: "true"}, true},
+		{"unpaused", map[string]string{PausedAnnotation: "true"}, nil, true},
+		{"dry run", nil, map[string]string{DryRunAnnotation: "true"}, true},
+		{"sync now", nil, map[string]string{SyncNowAnnotation: "1"}, true},
+		{"sync now again", map[string]string{SyncNowAnnotation: "1"}, map[string]string{SyncNowAnnotation: "2"}, true},
+		{"sync now cleared", map[string]string{SyncNowAnnotation: "1"}, nil, false},
+		{"other annotation", nil, map[string]string{"other": "true"}, false},
+	} {
+		changed := controlAnnotationsChanged.Update(event.UpdateEvent{ObjectOld: object(tc.old), ObjectNew: object(tc.new)})
+		if changed != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, changed)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package controllers
 import (
 	"errors"
 	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
 )
 
 const (
@@ -11,7 +13,7 @@ const (
 
 type VaultAppRoleAuth struct{}
 
-func (auth VaultAppRoleAuth) login() error {
+func (auth VaultAppRoleAuth) login(vaultClient *vaultapi.Client) error {
 	roleId, ok := os.LookupEnv("VAULT_APPROLE_ROLE_ID")
 	if !ok {
 		return errors.New("Environment variable VAULT_APPROLE_ROLE_ID not set")
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// secretValues returns the values of s by key, parsed from its plaintext, which is either the value of s.Key, or a
+// bundle with a value for each of its keys. The plaintext of a bundle in an envelope is the data key to open it with.
+func secretValues(s k8sv1alpha1.Secret, plaintext []byte, envelope *kmsutil.Envelope) (map[string]interface{}, error) {
+	if s.Bundle == nil {
+		value, err := format.Parse(s.Format, plaintext)
+		return map[string]interface{}{s.Key: value}, err
+	}
+	if envelope != nil {
+		var err error
+		plaintext, err = envelope.Open(plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("has an envelope that can't be opened: %v", err)
+		}
+	}
+	return format.ExpandBundle(s.Bundle.Format, plaintext, s.Bundle.Prefix, s.Bundle.Include, s.Bundle.Exclude)
+}
+
+// formatError reports that key, from the secret s, can't be parsed or encoded, and returns the terminal error that
+// fails the sync, since writing the secret without it could break its consumers.
+func formatError(ctx context.Context, secret *k8sv1alpha1.KMSVaultSecret, s k8sv1alpha1.Secret, key string, err error) error {
+	logf.FromContext(ctx).Info("Error parsing secret", "secretKey", key, "format", s.Format, "outputEncoding", s.OutputEncoding, "reason", err.Error())
+	rec.Event(secret, corev1.EventTypeWarning, "FormatError", fmt.Sprintf("Key %s %v", key, err))
+	return terminalErr(fmt.Errorf("Key %s %w", key, err))
+}
+
+// keySources keeps track of the secret each key is set by, so that a bundle can't silently set the same key as
+// another secret. Keys set by more than one secret without a bundle (e.g. in an included PartialKMSVaultSecret) are
+// still written with the last one.
+type keySources map[string]k8sv1alpha1.Secret
+
+func (k keySources) add(key string, s k8sv1alpha1.Secret) error {
+	previous, ok := k[key]
+	if ok && (previous.Bundle != nil || s.Bundle != nil) {
+		return terminalErr(fmt.Errorf("Key %s is set by both %s and %s", key, previous.Key, s.Key))
+	}
+	k[key] = s
+	return nil
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+)
+
+const testDataKey = "0123456789abcdef0123456789abcdef"
+
+// sealTestEnvelope encrypts plaintext under testDataKey, which fakeKMS decrypts from keyCiphertext.
+func sealTestEnvelope(t *testing.T, keyCiphertext string, plaintext string) string {
+	block, err := aes.NewCipher([]byte(testDataKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	envelope, err := json.Marshal(kmsutil.Envelope{
+		Key:        []byte(keyCiphertext),
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, []byte(plaintext), nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(envelope)
+}
+
+func TestDecryptSecretsBundles(t *testing.T) {
+	data, err := decryptFormatted(t,
+		map[string]string{
+			"dotenv-ciphertext": "# app\nUSER=admin\nPASSWORD=\"p@ss word\"\nDEBUG=true\n",
+			"json-ciphertext":   `{"host": "db.example.com", "port": 5432, "replica": {"host": "replica.example.com"}}`,
+			"key-ciphertext":    testDataKey,
+			"user-ciphertext":   "other",
+		},
+		k8sv1alpha1.Secret{Key: "app", EncryptedSecret: "dotenv-ciphertext", Bundle: &k8sv1alpha1.Bundle{Format: format.Dotenv, Exclude: []string{"DEBUG"}}},
+		k8sv1alpha1.Secret{Key: "database", EncryptedSecret: "json-ciphertext", Bundle: &k8sv1alpha1.Bundle{Format: format.JSON, Prefix: "db_", Include: []string{"host", "port"}}},
+		k8sv1alpha1.Secret{Key: "large", EncryptedSecret: sealTestEnvelope(t, "key-ciphertext", "large: value\n"), Bundle: &k8sv1alpha1.Bundle{Format: format.YAML, Envelope: true}},
+		k8sv1alpha1.Secret{Key: "user", EncryptedSecret: "user-ciphertext"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"USER":     "admin",
+		"PASSWORD": "p@ss word",
+		"db_host":  "db.example.com",
+		"db_port":  json.Number("5432"),
+		"large":    "value",
+		"user":     "other",
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, data)
+	}
+}
+
+func TestDecryptSecretsBundleTemplates(t *testing.T) {
+	data, _, err := decryptTemplated(t,
+		[]k8sv1alpha1.Template{{Key: "database", Template: "{{ .db_host }}:{{ .db_port }}"}},
+		k8sv1alpha1.Secret{Key: "database", EncryptedSecret: "database-ciphertext", Bundle: &k8sv1alpha1.Bundle{Format: format.JSON, Prefix: "db_"}, TemplateOnly: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"database": "db.example.com:5432"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, data)
+	}
+	_, _, err = decryptTemplated(t,
+		[]k8sv1alpha1.Template{{Key: "db_host", Template: "{{ .db_port }}"}},
+		k8sv1alpha1.Secret{Key: "database", EncryptedSecret: "database-ciphertext", Bundle: &k8sv1alpha1.Bundle{Format: format.JSON, Prefix: "db_"}},
+	)
+	if err == nil || classifyError(err) != TerminalError {
+		t.Errorf("Expected a terminal error for a template with the key of a bundle, got %v", err)
+	}
+}
+
+func TestDecryptSecretsBundleErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		plaintexts map[string]string
+		secrets    []k8sv1alpha1.Secret
+	}{
+		"collision": {
+			map[string]string{"bundle-ciphertext": "PASSWORD=p@ss word\n", "password-ciphertext": "hunter2"},
+			[]k8sv1alpha1.Secret{
+				{Key: "PASSWORD", EncryptedSecret: "password-ciphertext"},
+				{Key: "app", EncryptedSecret: "bundle-ciphertext", Bundle: &k8sv1alpha1.Bundle{Format: format.Dotenv}},
+			},
+		},
+		"not an object": {
+			map[string]string{"bundle-ciphertext": `["p@ss word"]`},
+			[]k8sv1alpha1.Secret{{Key: "app", EncryptedSecret: "bundle-ciphertext", Bundle: &k8sv1alpha1.Bundle{Format: format.JSON}}},
+		},
+		"invalid dotenv": {
+			map[string]string{"bundle-ciphertext": "p@ss word\n"},
+			[]k8sv1alpha1.Secret{{Key: "app", EncryptedSecret: "bundle-ciphertext", Bundle: &k8sv1alpha1.Bundle{Format: format.Dotenv}}},
+		},
+		"wrong data key": {
+			map[string]string{"key-ciphertext": strings.Repeat("x", 32)},
+			[]k8sv1alpha1.Secret{{Key: "app", EncryptedSecret: sealTestEnvelope(t, "key-ciphertext", "PASSWORD=p@ss word\n"), Bundle: &k8sv1alpha1.Bundle{Format: format.Dotenv, Envelope: true}}},
+		},
+	} {
+		_, err := decryptFormatted(t, tc.plaintexts, tc.secrets...)
+		if err == nil || classifyError(err) != TerminalError {
+			t.Errorf("%s: expected a terminal error, got %v", name, err)
+			continue
+		}
+		if strings.Contains(err.Error(), "p@ss word") {
+			t.Errorf("%s: plaintext found in %s", name, err)
+		}
+	}
+}
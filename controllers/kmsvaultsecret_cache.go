@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+)
+
+// plaintextCache is an in-memory LRU cache of decrypted values, keyed by a hash of the KMS client, the ciphertext and
+// its encryption context. The cache's own copies of the values are zeroed out when they're evicted, but they're copied
+// to regular memory whenever they're used, so this only limits how long the cache itself holds them.
+type plaintextCache struct {
+	lock       sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type plaintextCacheEntry struct {
+	key       string
+	plaintext []byte
+	keyID     string
+	expires   time.Time
+}
+
+var decryptedCache *plaintextCache
+
+func newPlaintextCache(ttl time.Duration, maxEntries int) *plaintextCache {
+	return &plaintextCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// plaintextCacheKey identifies a value by everything its decryption depends on. The KMS client is part of it, since
+// a ciphertext that was decrypted with one region or role must go through the IAM checks of another one again.
+func plaintextCacheKey(config kmsutil.ClientConfig, ciphertext []byte, context map[string]*string) string {
+	h := sha256.New()
+	writeWithLength(h, []byte(config.Region))
+	writeWithLength(h, []byte(config.RoleARN))
+	writeWithLength(h, []byte(config.ExternalID))
+	writeWithLength(h, ciphertext)
+	keys := make([]string, 0, len(context))
+	for k := range context {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeWithLength(h, []byte(k))
+		if context[k] != nil {
+			writeWithLength(h, []byte(*context[k]))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeWithLength(h hash.Hash, b []byte) {
+	l := make([]byte, 8)
+	binary.BigEndian.PutUint64(l, uint64(len(b)))
+	h.Write(l)
+	h.Write(b)
+}
+
+// get returns a copy of the cached plaintext for key, and the ARN of the KMS key it was encrypted with.
+func (c *plaintextCache) get(key string) ([]byte, string, bool) {
+	if c == nil {
+		return nil, "", false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		plaintextCacheRequests.WithLabelValues("miss").Inc()
+		return nil, "", false
+	}
+	entry := element.Value.(*plaintextCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.evict(element)
+		plaintextCacheRequests.WithLabelValues("miss").Inc()
+		return nil, "", false
+	}
+	c.lru.MoveToFront(element)
+	plaintextCacheRequests.WithLabelValues("hit").Inc()
+	plaintext := make([]byte, len(entry.plaintext))
+	copy(plaintext, entry.plaintext)
+	return plaintext, entry.keyID, true
+}
+
+func (c *plaintextCache) put(key string, plaintext []byte, keyID string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.evict(element)
+	}
+	for c.lru.Len() > 0 && c.lru.Len() >= c.maxEntries {
+		c.evict(c.lru.Back())
+	}
+	stored := make([]byte, len(plaintext))
+	copy(stored, plaintext)
+	c.entries[key] = c.lru.PushFront(&plaintextCacheEntry{key: key, plaintext: stored, keyID: keyID, expires: time.Now().Add(c.ttl)})
+}
+
+func (c *plaintextCache) evict(element *list.Element) {
+	entry := c.lru.Remove(element).(*plaintextCacheEntry)
+	delete(c.entries, entry.key)
+	for i := range entry.plaintext {
+		entry.plaintext[i] = 0
+	}
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+)
+
+func TestPlaintextCacheKey(t *testing.T) {
+	ciphertext := []byte("ciphertext")
+	context := aws.StringMap(map[string]string{"app": "api"})
+	key := plaintextCacheKey(kmsutil.ClientConfig{}, ciphertext, context)
+	if key != plaintextCacheKey(kmsutil.ClientConfig{}, []byte("ciphertext"), aws.StringMap(map[string]string{"app": "api"})) {
+		t.Error("Expected the same key for the same inputs")
+	}
+	for name, other := range map[string]string{
+		"ciphertext":  plaintextCacheKey(kmsutil.ClientConfig{}, []byte("ciphertext2"), context),
+		"context":     plaintextCacheKey(kmsutil.ClientConfig{}, ciphertext, aws.StringMap(map[string]string{"app": "web"})),
+		"no context":  plaintextCacheKey(kmsutil.ClientConfig{}, ciphertext, nil),
+		"region":      plaintextCacheKey(kmsutil.ClientConfig{Region: "eu-west-1"}, ciphertext, context),
+		"role":        plaintextCacheKey(kmsutil.ClientConfig{RoleARN: "arn:aws:iam::123456789012:role/other"}, ciphertext, context),
+		"external ID": plaintextCacheKey(kmsutil.ClientConfig{RoleARN: "arn:aws:iam::123456789012:role/other", ExternalID: "id"}, ciphertext, context),
+	} {
+		if other == key {
+			t.Errorf("Expected a different %s to change the key", name)
+		}
+	}
+}
+
+func TestPlaintextCache(t *testing.T) {
+	c := newPlaintextCache(time.Hour, 2)
+	c.put("a", []byte("plaintext-a"), "key-a")
+	c.put("b", []byte("plaintext-b"), "key-b")
+
+	plaintext, keyID, ok := c.get("a")
+	if !ok || string(plaintext) != "plaintext-a" || keyID != "key-a" {
+		t.Fatalf("Expected a hit for a, got %q, %q, %v", plaintext, keyID, ok)
+	}
+	plaintext[0] = 'X'
+	if plaintext, _, _ := c.get("a"); string(plaintext) != "plaintext-a" {
+		t.Errorf("Expected get to return a copy, the cached value changed to %q", plaintext)
+	}
+
+	// a was used last, so b is the least recently used entry.
+	evicted := c.entries["b"].Value.(*plaintextCacheEntry).plaintext
+	c.put("c", []byte("plaintext-c"), "key-c")
+	if _, _, ok := c.get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	for _, b := range evicted {
+		if b != 0 {
+			t.Errorf("Expected the evicted value to be zeroed out, got %q", evicted)
+			break
+		}
+	}
+	if _, _, ok := c.get("a"); !ok {
+		t.Error("Expected the most recently used entry to be kept")
+	}
+
+	expired := newPlaintextCache(-time.Second, 2)
+	expired.put("a", []byte("plaintext-a"), "key-a")
+	if _, _, ok := expired.get("a"); ok {
+		t.Error("Expected an expired entry to be a miss")
+	}
+	if len(expired.entries) != 0 {
+		t.Error("Expected an expired entry to be evicted")
+	}
+
+	var disabled *plaintextCache
+	disabled.put("a", []byte("plaintext-a"), "key-a")
+	if _, _, ok := disabled.get("a"); ok {
+		t.Error("Expected a disabled cache to always miss")
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+)
+
+// contextKMS decrypts any ciphertext, as long as it's decrypted with context as its encryption context.
+type contextKMS struct {
+	kmsiface.KMSAPI
+	context map[string]string
+}
+
+func (k contextKMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if !reflect.DeepEqual(aws.StringValueMap(input.EncryptionContext), k.context) {
+		return nil, awserr.New(kms.ErrCodeInvalidCiphertextException, "", nil)
+	}
+	return &kms.DecryptOutput{Plaintext: []byte("value"), KeyId: aws.String(testKMSKey)}, nil
+}
+
+func TestDecryptSecretsInjectedContext(t *testing.T) {
+	defer func() { InjectNamespaceContext, InjectNameContext = false, false }()
+	for name, tc := range map[string]struct {
+		injectNamespace bool
+		injectName      bool
+		secretContext   map[string]string
+		expected        map[string]string
+	}{
+		"disabled":                {false, false, map[string]string{"app": "api"}, map[string]string{"app": "api"}},
+		"namespace":               {true, false, map[string]string{"app": "api"}, map[string]string{"app": "api", "kubernetes_namespace": "default"}},
+		"name":                    {true, true, nil, map[string]string{"kubernetes_namespace": "default", "kubernetes_name": "test"}},
+		"name requires namespace": {false, true, nil, map[string]string{}},
+		"injected values win":     {true, true, map[string]string{"kubernetes_namespace": "other", "kubernetes_name": "other"}, map[string]string{"kubernetes_namespace": "default", "kubernetes_name": "test"}},
+	} {
+		InjectNamespaceContext, InjectNameContext = tc.injectNamespace, tc.injectName
+		secrets := []k8sv1alpha1.Secret{{Key: "password", EncryptedSecret: "Y2lwaGVydGV4dA==", SecretContext: tc.secretContext}}
+		data, err := decryptSecretsWithKMS(t, contextKMS{context: tc.expected}, decryptOptions{}, secrets)
+		if err != nil || data["password"] != "value" {
+			t.Errorf("%s: expected the secret to be decrypted with the context %v, got %v, %v", name, tc.expected, data, err)
+		}
+	}
+}
@@ -21,48 +21,141 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
 	"github.com/go-logr/logr"
 	"github.com/radovskyb/watcher"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	vaultapi "github.com/hashicorp/vault/api"
 	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/logging"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	"github.com/patoarvizu/kms-vault-operator/pkg/redact"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
+	"github.com/patoarvizu/kms-vault-operator/pkg/validation"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type VaultAuthMethod interface {
-	login() error
+	login(*vaultapi.Client) error
 }
 
-func renewToken(m VaultAuthMethod) error {
-	tokenLookup, err := vaultClient.Auth().Token().LookupSelf()
+// tokenCheckInterval is how long a token that was looked up is trusted for (or less, if it expires before that)
+// without looking it up again, so that a revoked token is still noticed.
+const tokenCheckInterval = time.Minute
+
+// renewToken makes sure that the shared Vault client has a valid token, renewing it or logging in again if required.
+// Only the time until the token has to be checked again is read under tokenLock, and concurrent reconciles that need
+// to check it share a single lookup, renewal or login, so that they don't wait on each other otherwise.
+func renewToken(ctx context.Context, m VaultAuthMethod) error {
+	tokenLock.Lock()
+	trusted := time.Now().Before(tokenTrustedUntil)
+	tokenLock.Unlock()
+	if trusted {
+		return nil
+	}
+	_, err, _ := tokenRefresh.Do("token", func() (interface{}, error) {
+		return nil, refreshToken(ctx, m)
+	})
+	return err
+}
+
+// refreshToken looks up the token of the shared Vault client, and renews it or logs in again if it expired.
+func refreshToken(ctx context.Context, m VaultAuthMethod) (err error) {
+	ctx, span := tracing.Start(ctx, "Vault.RenewToken", tracing.VaultAuthMethodKey.String(VaultAuthenticationMethod))
+	defer func() { tracing.End(span, err) }()
+	vaultClient := getVaultClient()
+	tokenLookup, err := tracing.VaultClient(ctx, vaultClient).Auth().Token().LookupSelf()
 	if err == nil {
-		expiration := tokenLookup.Data["expire_time"]
-		t, err := time.Parse(time.RFC3339, expiration.(string))
+		recordTokenTTL(tokenLookup)
+		// Tokens that never expire, like root tokens, don't have an expiration time.
+		expiration, ok := tokenLookup.Data["expire_time"].(string)
+		if !ok {
+			trustToken(tokenLookup)
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, expiration)
 		if err == nil {
 			now := time.Now()
 			if t.After(now) {
+				trustToken(tokenLookup)
 				return nil
 			}
 			renewable, _ := tokenLookup.TokenIsRenewable()
 			if renewable {
-				vaultClient.Auth().Token().RenewSelf(0)
-				return nil
+				vaultAuthAttempts.WithLabelValues(VaultAuthenticationMethod, "renew").Inc()
+				renewed, err := tracing.VaultClient(ctx, vaultClient).Auth().Token().RenewSelf(0)
+				if err == nil {
+					recordTokenTTL(renewed)
+					trustToken(renewed)
+					return nil
+				}
+				vaultAuthFailures.WithLabelValues(VaultAuthenticationMethod, "renew").Inc()
 			}
 		}
 	}
-	return m.login()
+	return login(ctx, m, vaultClient)
+}
+
+// trustToken skips looking up the token described by secret for tokenCheckInterval, or until it expires.
+func trustToken(secret *vaultapi.Secret) {
+	until := time.Now().Add(tokenCheckInterval)
+	ttl, err := secret.TokenTTL()
+	if err == nil && ttl > 0 && time.Now().Add(ttl).Before(until) {
+		until = time.Now().Add(ttl)
+	}
+	tokenLock.Lock()
+	defer tokenLock.Unlock()
+	tokenTrustedUntil = until
+}
+
+// forgetToken makes the next reconcile look up the token again, e.g. after Vault rejected it.
+func forgetToken() {
+	tokenLock.Lock()
+	defer tokenLock.Unlock()
+	tokenTrustedUntil = time.Time{}
+}
+
+// login logs in to Vault with m and records the attempt.
+func login(ctx context.Context, m VaultAuthMethod, vaultClient *vaultapi.Client) error {
+	ctx, span := tracing.Start(ctx, "Vault.Login", tracing.VaultAuthMethodKey.String(VaultAuthenticationMethod))
+	vaultAuthAttempts.WithLabelValues(VaultAuthenticationMethod, "login").Inc()
+	err := m.login(vaultClient)
+	tracing.End(span, err)
+	if err != nil {
+		vaultAuthFailures.WithLabelValues(VaultAuthenticationMethod, "login").Inc()
+		return err
+	}
+	tokenLookup, err := tracing.VaultClient(ctx, vaultClient).Auth().Token().LookupSelf()
+	if err == nil {
+		recordTokenTTL(tokenLookup)
+		trustToken(tokenLookup)
+	}
+	return nil
 }
 
 func watchCertificate() {
@@ -95,8 +188,18 @@ func watchCertificate() {
 }
 
 type KVWriter interface {
-	write(*k8sv1alpha1.KMSVaultSecret, *vaultapi.Client) error
-	delete(*k8sv1alpha1.KMSVaultSecret, *vaultapi.Client) error
+	write(context.Context, *k8sv1alpha1.KMSVaultSecret, string, decryptOptions, *vaultapi.Client) error
+	read(context.Context, string, *vaultapi.Client) (map[string]interface{}, error)
+	delete(context.Context, string, *vaultapi.Client) error
+}
+
+// decryptOptions holds the restrictions that apply when decrypting the secrets of a single KMSVaultSecret.
+type decryptOptions struct {
+	// allowedKeys are the KMS key allowlists that apply to the object, each of them must allow the key used to
+	// encrypt a secret for it to be decrypted.
+	allowedKeys []kmsutil.KeyAllowlist
+	// requiredContext are the keys that must be in the encryption context of a secret for it to be decrypted.
+	requiredContext []policy.ContextRequirement
 }
 
 const (
@@ -109,23 +212,45 @@ const (
 	KVv1                         string = "v1"
 	KVv2                         string = "v2"
 	DeletedFinalizer             string = "delete.k8s.patoarvizu.dev"
+	SyncedCondition              string = "Synced"
+	SyncedReason                 string = "Synced"
 )
 
 var log = logf.Log.WithName("controller_kmsvaultsecret")
 var rec record.EventRecorder
 var reqLogger logr.Logger
 var vaultClient *vaultapi.Client
+var vaultClientLock sync.RWMutex
+var tokenLock sync.Mutex
+var tokenTrustedUntil time.Time
+var tokenRefresh singleflight.Group
 var vaultAuthMethod VaultAuthMethod
+var kmsLimiter = rate.NewLimiter(rate.Inf, 0)
+var kmsClients *kmsutil.ClientCache
 
+// setVaultClient replaces the shared Vault client with a new one, e.g. when the CA certificate changes. The token of
+// the previous client is kept, and looked up again on the next reconcile.
 func setVaultClient() error {
 	c, err := vaultapi.NewClient(vaultapi.DefaultConfig())
 	if err != nil {
 		return err
 	}
+	vaultClientLock.Lock()
+	if vaultClient != nil && len(vaultClient.Token()) > 0 {
+		c.SetToken(vaultClient.Token())
+	}
 	vaultClient = c
+	vaultClientLock.Unlock()
+	forgetToken()
 	return nil
 }
 
+func getVaultClient() *vaultapi.Client {
+	vaultClientLock.RLock()
+	defer vaultClientLock.RUnlock()
+	return vaultClient
+}
+
 // KMSVaultSecretReconciler reconciles a KMSVaultSecret object
 type KMSVaultSecretReconciler struct {
 	client.Client
@@ -136,24 +261,52 @@ type KMSVaultSecretReconciler struct {
 // +kubebuilder:rbac:groups=k8s.patoarvizu.dev,resources=kmsvaultsecrets,verbs=get;list;watch;create;update;patch
 // +kubebuilder:rbac:groups=k8s.patoarvizu.dev,resources=partialkmsvaultsecrets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=k8s.patoarvizu.dev,resources=kmsvaultsecrets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=k8s.patoarvizu.dev,resources=kmsvaultnamespaceconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=k8s.patoarvizu.dev,resources=kmsvaultpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create
 
 func (r *KMSVaultSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	reqLogger := log.WithValues("Request.Namespace", req.Namespace, "Request.Name", req.Name)
+	ctx, span := tracing.Start(ctx, "Reconcile", tracing.NamespaceKey.String(req.Namespace), tracing.NameKey.String(req.Name))
+	defer span.End()
+	// The logger of controller-runtime already has the namespace and name of the object.
+	reqLogger := logf.FromContext(ctx, logging.ReconcileIDKey, string(uuid.NewUUID()))
+	ctx = logf.IntoContext(ctx, reqLogger)
 	reqLogger.Info("Reconciling KMSVaultSecret")
 
 	instance := &k8sv1alpha1.KMSVaultSecret{}
 	err := r.Client.Get(ctx, req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			retries.reset(req.NamespacedName)
+			syncStates.forget(req.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		return reconcile.Result{}, err
 	}
 
+	if isPaused(instance) {
+		return r.paused(ctx, instance)
+	}
+	r.updateCondition(ctx, instance, PausedCondition, nil)
+	syncNow := syncNowRequested(instance)
+	if syncNow {
+		reqLogger.Info("Sync requested with the sync-now annotation")
+		retries.reset(req.NamespacedName)
+		defer r.clearSyncNow(ctx, req.NamespacedName)
+	}
+
+	if instance.ObjectMeta.DeletionTimestamp == nil && hasTerminalError(instance) && !syncNow {
+		reqLogger.Info("Secret failed with a terminal error, waiting for its spec to change")
+		syncStates.observe(instance, false)
+		return reconcile.Result{}, nil
+	}
+
 	for _, partialSecretName := range instance.Spec.IncludeSecrets {
 		partialSecretInstance := &k8sv1alpha1.PartialKMSVaultSecret{}
+		_, partialSpan := tracing.Start(ctx, "ResolvePartial", tracing.NamespaceKey.String(req.Namespace), tracing.NameKey.String(partialSecretName))
 		err = r.Client.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: partialSecretName}, partialSecretInstance)
+		tracing.End(partialSpan, err)
 		if err != nil {
 			reqLogger.Info(fmt.Sprintf("Error getting included secret %s, skipping it...", partialSecretName))
 			continue
@@ -161,36 +314,113 @@ func (r *KMSVaultSecretReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		instance.Spec.Secrets = append(instance.Spec.Secrets, partialSecretInstance.Spec.Secrets...)
 	}
 
-	err = renewToken(vaultAuthMethod)
+	err = renewToken(ctx, vaultAuthMethod)
 	if err != nil {
-		reqLogger.Error(err, "Error getting authenticated Vault client")
-		return reconcile.Result{RequeueAfter: time.Second * 15}, err
+		reqLogger.Error(err, "Error getting authenticated Vault client", logging.AuthMethodKey, VaultAuthenticationMethod)
+		// Authentication doesn't depend on the object, so it's always retried, even if Vault rejected the login.
+		return r.syncFailed(ctx, instance, retryableErr(err))
 	}
 
-	writer := kvWriter(instance.Spec.KVSettings.EngineVersion)
 	if instance.ObjectMeta.DeletionTimestamp != nil {
 		reqLogger.Info("Resource deleted, cleaning up")
-		err = writer.delete(instance, vaultClient)
-		if err != nil {
-			reqLogger.Error(err, "Error deleting secret from Vault")
-			return reconcile.Result{}, err
-		}
-		instance.Finalizers = removeFinalizer(instance.Finalizers, DeletedFinalizer)
-		r.Client.Update(ctx, instance)
-		return reconcile.Result{}, nil
+		return r.deleted(ctx, instance)
+	}
+	writer := kvWriter(engineVersion(instance))
+	target, err := policyTarget(instance)
+	if err != nil {
+		reqLogger.Error(err, "Error rendering path")
+		return r.syncFailed(ctx, instance, err)
 	}
+	reqLogger = reqLogger.WithValues(logging.PathKey, target.Path, logging.EngineKey, engineVersion(instance))
+	ctx = logf.IntoContext(ctx, reqLogger)
 
-	err = writer.write(instance, vaultClient)
+	decision, err := policy.Evaluate(ctx, r.Client, target)
+	if err != nil {
+		reqLogger.Error(err, "Error evaluating KMSVaultPolicies")
+		return r.syncFailed(ctx, instance, err)
+	}
+	if !decision.Allowed {
+		reqLogger.Info("Secret is not allowed by KMSVaultPolicies", "reason", decision.Message)
+		return r.policyViolation(ctx, instance, decision.Message)
+	}
+	options, err := r.decryptOptions(ctx, instance)
+	if err != nil {
+		reqLogger.Error(err, "Error getting decryption options")
+		return r.syncFailed(ctx, instance, err)
+	}
+	options.allowedKeys = append(options.allowedKeys, decision.AllowedKMSKeys)
+	if isDryRun(instance) {
+		return r.dryRun(ctx, instance, writer, target.Path, options)
+	}
+	r.updateCondition(ctx, instance, DryRunCondition, nil)
+	err = writer.write(ctx, instance, target.Path, options, getVaultClient())
 	if err != nil {
 		reqLogger.Error(err, "Error writing secret to Vault")
-		return reconcile.Result{RequeueAfter: time.Second * 15}, err
+		return r.syncFailed(ctx, instance, err)
 	}
+	err = r.cleanUpPreviousPath(ctx, instance, target.Path)
+	if err != nil {
+		reqLogger.Error(err, "Error cleaning up previous path")
+		return r.syncFailed(ctx, instance, err)
+	}
+	retries.reset(req.NamespacedName)
 	if !instance.Status.Created {
 		instance.Status.Created = true
-		rec.Event(instance, corev1.EventTypeNormal, "SecretCreated", fmt.Sprintf("Wrote secret %s to %s", instance.Name, instance.Spec.Path))
-		r.Client.Status().Update(ctx, instance)
+		rec.Event(instance, corev1.EventTypeNormal, "SecretCreated", fmt.Sprintf("Wrote secret %s to %s", instance.Name, target.Path))
+	}
+	instance.Status.Path = target.Path
+	instance.Status.PathTemplate = instance.Spec.Path
+	instance.Status.EngineVersion = engineVersion(instance)
+	r.updateSyncedCondition(ctx, instance, metav1.ConditionTrue, SyncedReason, fmt.Sprintf("Secret written to %s", target.Path))
+	return nextSync(ctx, instance), nil
+}
+
+// syncFailed records the class of err on the object status and decides when to try again. Terminal errors are not
+// retried until the object spec changes, while retryable ones are requeued with an exponential backoff. The error is
+// not returned to controller-runtime so that its own rate limiter doesn't compound the backoff.
+func (r *KMSVaultSecretReconciler) syncFailed(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret, err error) (ctrl.Result, error) {
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	class := classifyError(err)
+	if isVaultForbidden(err) && !retries.forbiddenAgain(key) {
+		// The token may have expired or been revoked, so the sync is retried once after looking it up again (and
+		// logging in if it's not valid anymore). A 403 with a token that was just checked is terminal.
+		forgetToken()
+		class = RetryableError
 	}
-	return reconcile.Result{RequeueAfter: time.Second * time.Duration(SyncPeriodSeconds)}, nil
+	syncErrors.WithLabelValues(string(class)).Inc()
+	tracing.RecordError(ctx, err)
+	r.updateSyncedCondition(ctx, instance, metav1.ConditionFalse, string(class), err.Error())
+	if class == TerminalError {
+		retries.reset(key)
+		rec.Event(instance, corev1.EventTypeWarning, "TerminalError", "Sync failed with an error that won't be retried until the spec changes")
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{RequeueAfter: retries.next(key)}, nil
+}
+
+func (r *KMSVaultSecretReconciler) updateSyncedCondition(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret, status metav1.ConditionStatus, reason string, message string) {
+	current := instance.Status.DeepCopy()
+	instance.Status.ObservedGeneration = instance.Generation
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               SyncedCondition,
+		Status:             status,
+		ObservedGeneration: instance.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	syncStates.observe(instance, status == metav1.ConditionTrue)
+	if equality.Semantic.DeepEqual(current, &instance.Status) {
+		return
+	}
+	err := r.Client.Status().Update(ctx, instance)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "Error updating status")
+	}
+}
+
+func hasTerminalError(instance *k8sv1alpha1.KMSVaultSecret) bool {
+	synced := meta.FindStatusCondition(instance.Status.Conditions, SyncedCondition)
+	return synced != nil && synced.Status == metav1.ConditionFalse && synced.Reason == string(TerminalError) && synced.ObservedGeneration == instance.Generation
 }
 
 func (r *KMSVaultSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -200,13 +430,24 @@ func (r *KMSVaultSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 	watchCertificate()
+	kmsClients, err = kmsutil.NewClientCache()
+	if err != nil {
+		return err
+	}
 	vaultAuthMethod = vaultAuthentication(VaultAuthenticationMethod)
-	err = vaultAuthMethod.login()
+	err = login(context.Background(), vaultAuthMethod, getVaultClient())
 	if err != nil {
 		return err
 	}
+	if KMSQPS > 0 {
+		kmsLimiter = rate.NewLimiter(rate.Limit(KMSQPS), KMSBurst)
+	}
+	if PlaintextCacheTTLSeconds > 0 {
+		decryptedCache = newPlaintextCache(time.Second*time.Duration(PlaintextCacheTTLSeconds), PlaintextCacheMaxEntries)
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&k8sv1alpha1.KMSVaultSecret{}).
+		For(&k8sv1alpha1.KMSVaultSecret{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, controlAnnotationsChanged))).
+		WithOptions(controller.Options{MaxConcurrentReconciles: MaxConcurrentReconciles}).
 		Complete(r)
 }
 
@@ -221,53 +462,147 @@ func removeFinalizer(allFinalizers []string, finalizer string) []string {
 	return result
 }
 
-func decryptSecrets(secret *k8sv1alpha1.KMSVaultSecret) (map[string]interface{}, error) {
-	logger := log.WithValues("Function", "decryptSecrets")
-	awsSession, err := session.NewSession()
+func (r *KMSVaultSecretReconciler) decryptOptions(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret) (decryptOptions, error) {
+	namespaceConfigs := &k8sv1alpha1.KMSVaultNamespaceConfigList{}
+	err := r.Client.List(ctx, namespaceConfigs, client.InNamespace(instance.Namespace))
 	if err != nil {
-		return nil, err
+		return decryptOptions{}, err
 	}
+	namespaceAllowedKeys := kmsutil.KeyAllowlist{}
+	requiredContextKeys := strings.Split(RequiredContextKeys, ",")
+	for _, c := range namespaceConfigs.Items {
+		namespaceAllowedKeys = append(namespaceAllowedKeys, c.Spec.AllowedKMSKeys...)
+		requiredContextKeys = append(requiredContextKeys, c.Spec.RequiredContextKeys...)
+	}
+	return decryptOptions{
+		allowedKeys:     []kmsutil.KeyAllowlist{kmsutil.ParseKeyAllowlist(AllowedKMSKeys), namespaceAllowedKeys},
+		requiredContext: policy.ParseContextRequirements(requiredContextKeys),
+	}, nil
+}
+
+func decryptSecrets(ctx context.Context, secret *k8sv1alpha1.KMSVaultSecret, options decryptOptions) (map[string]interface{}, error) {
+	logger := logf.FromContext(ctx, "Function", "decryptSecrets")
 	decryptedSecretData := map[string]interface{}{}
-	svc := kms.New(awsSession)
+	// templateData holds the values of every secret, including the template-only ones, before their output encoding.
+	templateData := map[string]interface{}{}
+	sources := keySources{}
+	svc := kmsClients.Client(validation.ClientConfig(secret))
+	injected := validation.InjectedContext(secret, validation.Rules{InjectNamespaceContext: InjectNamespaceContext, InjectNameContext: InjectNameContext})
 	for _, s := range secret.Spec.Secrets {
 		if s.EmptySecret {
 			if len(s.EncryptedSecret) > 0 {
-				logger.Info("Secret is marked as empty, ignoring content", "secretKey", s.Key, "encodedString", s.EncryptedSecret)
+				logger.Info("Secret is marked as empty, ignoring content", "secretKey", s.Key, "ciphertext", redact.Ciphertext(s.EncryptedSecret))
+			}
+			err := sources.add(s.Key, s)
+			if err != nil {
+				return nil, err
+			}
+			templateData[s.Key] = ""
+			if !s.TemplateOnly {
+				decryptedSecretData[s.Key] = ""
 			}
-			decryptedSecretData[s.Key] = ""
 			continue
 		}
 		decoded, err := base64.StdEncoding.DecodeString(s.EncryptedSecret)
+		var envelope *kmsutil.Envelope
+		if err == nil && s.Bundle != nil && s.Bundle.Envelope {
+			envelope, err = kmsutil.ParseEnvelope(decoded)
+			if err == nil {
+				decoded = envelope.Key
+			}
+		}
 		if err != nil {
-			logger.Info("Error decoding secret, skipping", "secretKey", s.Key, "encodedString", s.EncryptedSecret)
+			logger.Info("Error decoding secret", "secretKey", s.Key, "ciphertext", redact.Ciphertext(s.EncryptedSecret))
+			kmsMetrics.Rejected(kmsutil.UnknownKey, "DecodingError")
 			rec.Event(secret, corev1.EventTypeWarning, "DecodingError", fmt.Sprintf("Error decoding key %s", s.Key))
-			continue
+			return nil, terminalErr(fmt.Errorf("Error decoding key %s", s.Key))
 		}
-		result, err := svc.Decrypt(&kms.DecryptInput{CiphertextBlob: decoded, EncryptionContext: getApplicableContext(s.SecretContext, secret.Spec.SecretContext)})
+		encryptionContext := validation.ApplicableContext(s.SecretContext, secret.Spec.SecretContext, injected)
+		reason, err := policy.CheckContext(options.requiredContext, encryptionContext, secret)
 		if err != nil {
-			logger.Info("Error decrypting secret, skipping", "secretKey", s.Key, "encodedString", s.EncryptedSecret)
-			rec.Event(secret, corev1.EventTypeWarning, "DecryptingError", fmt.Sprintf("Error decrypting key %s", s.Key))
-			continue
+			return nil, err
 		}
-		decryptedSecretData[s.Key] = string(result.Plaintext)
+		if len(reason) > 0 {
+			logger.Info("Secret doesn't have the required encryption context", "secretKey", s.Key, "reason", reason)
+			kmsMetrics.Rejected(kmsutil.UnknownKey, "EncryptionContextNotAllowed")
+			rec.Event(secret, corev1.EventTypeWarning, "EncryptionContextNotAllowed", fmt.Sprintf("Key %s %s", s.Key, reason))
+			return nil, terminalErr(fmt.Errorf("Key %s %s", s.Key, reason))
+		}
+		cacheKey := plaintextCacheKey(validation.ClientConfig(secret), decoded, encryptionContext)
+		plaintext, keyID, cached := decryptedCache.get(cacheKey)
+		if !cached {
+			err = kmsLimiter.Wait(ctx)
+			if err != nil {
+				return nil, err
+			}
+			_, span := tracing.Start(ctx, "KMS.Decrypt", tracing.NamespaceKey.String(secret.Namespace), tracing.NameKey.String(secret.Name), tracing.SecretKeyKey.String(s.Key))
+			result, err := kmsMetrics.Decrypt(svc, &kms.DecryptInput{CiphertextBlob: decoded, EncryptionContext: encryptionContext, KeyId: kmsutil.DecryptKeyID(options.allowedKeys...)})
+			if err == nil {
+				span.SetAttributes(tracing.KMSKeyKey.String(aws.StringValue(result.KeyId)))
+			}
+			tracing.End(span, err)
+			if err != nil && classifyError(err) == RetryableError {
+				return nil, fmt.Errorf("Error decrypting key %s: %w", s.Key, err)
+			}
+			if err != nil {
+				logger.Info("Error decrypting secret", "secretKey", s.Key, "ciphertext", redact.Ciphertext(s.EncryptedSecret), "reason", kmsutil.ErrorReason(err))
+				rec.Event(secret, corev1.EventTypeWarning, "DecryptingError", fmt.Sprintf("Error decrypting key %s", s.Key))
+				return nil, terminalErr(fmt.Errorf("Error decrypting key %s: %s", s.Key, kmsutil.ErrorReason(err)))
+			}
+			plaintext, keyID = result.Plaintext, aws.StringValue(result.KeyId)
+			decryptedCache.put(cacheKey, result.Plaintext, keyID)
+		}
+		allowed, err := keyAllowed(svc, options, keyID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			logger.Info("Secret is encrypted with a KMS key that is not allowed", "secretKey", s.Key, "kmsKey", keyID)
+			kmsMetrics.Rejected(keyID, "KMSKeyNotAllowed")
+			rec.Event(secret, corev1.EventTypeWarning, "KMSKeyNotAllowed", fmt.Sprintf("Key %s is encrypted with KMS key %s, which is not allowed", s.Key, keyID))
+			return nil, terminalErr(fmt.Errorf("Key %s is encrypted with KMS key %s, which is not allowed", s.Key, keyID))
+		}
+		values, err := secretValues(s, plaintext, envelope)
+		if err != nil {
+			return nil, formatError(ctx, secret, s, s.Key, err)
+		}
+		for k, v := range values {
+			err = sources.add(k, s)
+			if err != nil {
+				return nil, err
+			}
+			templateData[k] = v
+			if s.TemplateOnly {
+				continue
+			}
+			encoded, err := format.Encode(s.OutputEncoding, v)
+			if err != nil {
+				return nil, formatError(ctx, secret, s, k, err)
+			}
+			decryptedSecretData[k] = encoded
+		}
+	}
+	err := renderTemplates(ctx, secret, templateData, decryptedSecretData)
+	if err != nil {
+		return nil, err
 	}
 	return decryptedSecretData, nil
 }
 
-func getApplicableContext(lowerContext map[string]string, higherContext map[string]string) map[string]*string {
-	if len(lowerContext) > 0 {
-		return convertContextMap(lowerContext)
-	} else {
-		return convertContextMap(higherContext)
+func keyAllowed(svc kmsiface.KMSAPI, options decryptOptions, keyID string) (bool, error) {
+	for _, allowlist := range options.allowedKeys {
+		allowed, err := allowlist.Allows(svc, keyID)
+		if err != nil || !allowed {
+			return false, err
+		}
 	}
+	return true, nil
 }
 
-func convertContextMap(context map[string]string) map[string]*string {
-	m := make(map[string]*string)
-	for k, v := range context {
-		m[k] = &v
-	}
-	return m
+// VaultLogin logs vaultClient in with vaultAuthenticationMethod, one of the values of --vault-authentication-method,
+// configured from the same environment variables as the operator.
+func VaultLogin(vaultAuthenticationMethod string, vaultClient *vaultapi.Client) error {
+	return vaultAuthentication(vaultAuthenticationMethod).login(vaultClient)
 }
 
 func vaultAuthentication(vaultAuthenticationMethod string) VaultAuthMethod {
@@ -287,6 +622,14 @@ func vaultAuthentication(vaultAuthenticationMethod string) VaultAuthMethod {
 	}
 }
 
+// engineVersion returns the KV engine version of instance, which is v1 if it's not set.
+func engineVersion(instance *k8sv1alpha1.KMSVaultSecret) string {
+	if len(instance.Spec.KVSettings.EngineVersion) == 0 {
+		return KVv1
+	}
+	return instance.Spec.KVSettings.EngineVersion
+}
+
 func kvWriter(kvVersion string) KVWriter {
 	switch kvVersion {
 	case KVv2:
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func decryptFormatted(t *testing.T, plaintexts map[string]string, secrets ...k8sv1alpha1.Secret) (map[string]interface{}, error) {
+	var err error
+	kmsClients, err = kmsutil.NewClientCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmsClients.SetClient(kmsutil.ClientConfig{}, fakeKMS{plaintexts: plaintexts})
+	rec = record.NewFakeRecorder(100)
+	for i := range secrets {
+		secrets[i].EncryptedSecret = base64.StdEncoding.EncodeToString([]byte(secrets[i].EncryptedSecret))
+	}
+	secret := &k8sv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec:       k8sv1alpha1.KMSVaultSecretSpec{Secrets: secrets},
+	}
+	return decryptSecrets(context.Background(), secret, decryptOptions{})
+}
+
+func TestDecryptSecretsFormats(t *testing.T) {
+	data, err := decryptFormatted(t,
+		map[string]string{
+			"string-ciphertext": `{"a": 1}`,
+			"json-ciphertext":   `{"a": 12345678901234567890, "b": [true, "c"]}`,
+			"yaml-ciphertext":   "a: 1\nb:\n  - c\n",
+			"base64-ciphertext": base64.StdEncoding.EncodeToString([]byte("decoded")),
+		},
+		k8sv1alpha1.Secret{Key: "string", EncryptedSecret: "string-ciphertext"},
+		k8sv1alpha1.Secret{Key: "json", EncryptedSecret: "json-ciphertext", Format: format.JSON},
+		k8sv1alpha1.Secret{Key: "yaml", EncryptedSecret: "yaml-ciphertext", Format: format.YAML},
+		k8sv1alpha1.Secret{Key: "base64", EncryptedSecret: "base64-ciphertext", Format: format.Base64},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"string": `{"a": 1}`,
+		"json":   map[string]interface{}{"a": json.Number("12345678901234567890"), "b": []interface{}{true, "c"}},
+		"yaml":   map[string]interface{}{"a": json.Number("1"), "b": []interface{}{"c"}},
+		"base64": "decoded",
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, data)
+	}
+}
+
+func TestDecryptSecretsInvalidFormat(t *testing.T) {
+	for _, tc := range []struct {
+		format    string
+		plaintext string
+	}{
+		{format.JSON, `{"password": "hunter2"`},
+		{format.JSON, `{"password": "hunter2"} trailing`},
+		{format.YAML, "password: [hunter2\n"},
+		{format.Base64, "hunter2!"},
+	} {
+		_, err := decryptFormatted(t, map[string]string{"ciphertext": tc.plaintext}, k8sv1alpha1.Secret{Key: "password", EncryptedSecret: "ciphertext", Format: tc.format})
+		if err == nil {
+			t.Errorf("Expected %q to be invalid %s", tc.plaintext, tc.format)
+			continue
+		}
+		if classifyError(err) != TerminalError || !strings.HasPrefix(err.Error(), "Key password is not valid") {
+			t.Errorf("Expected a terminal error about key password, got %v", err)
+		}
+		if strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("The error includes the plaintext: %v", err)
+		}
+	}
+}
+
+func TestWriteBinarySecrets(t *testing.T) {
+	binary := string([]byte{0x30, 0x82, 0xff, 0xfe, 0x00})
+	_, err := decryptFormatted(t, map[string]string{"ciphertext": binary}, k8sv1alpha1.Secret{Key: "keystore", EncryptedSecret: "ciphertext"})
+	if err == nil || !strings.Contains(err.Error(), "UTF-8") {
+		t.Errorf("Expected binary plaintext to be rejected with the raw encoding, got %v", err)
+	}
+	_, err = decryptFormatted(t, map[string]string{"ciphertext": "{}"}, k8sv1alpha1.Secret{Key: "keystore", EncryptedSecret: "ciphertext", Format: format.JSON, OutputEncoding: format.Base64})
+	if err == nil {
+		t.Error("Expected the base64 encoding to be rejected for the json format")
+	}
+
+	for _, writer := range []KVWriter{KVv1Writer{}, KVv2Writer{}} {
+		bodies := []map[string]interface{}{}
+		vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			body := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		vaultClient, err := vaultapi.NewClient(&vaultapi.Config{Address: vault.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kmsClients.SetClient(kmsutil.ClientConfig{}, fakeKMS{plaintexts: map[string]string{"ciphertext": binary}})
+		secret := &k8sv1alpha1.KMSVaultSecret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+			Spec: k8sv1alpha1.KMSVaultSecretSpec{
+				Secrets: []k8sv1alpha1.Secret{{Key: "keystore", EncryptedSecret: base64.StdEncoding.EncodeToString([]byte("ciphertext")), OutputEncoding: format.Base64}},
+			},
+		}
+		err = writer.write(context.Background(), secret, "secret/data/test", decryptOptions{}, vaultClient)
+		vault.Close()
+		if err != nil {
+			t.Fatalf("%T: %v", writer, err)
+		}
+		if len(bodies) != 1 {
+			t.Fatalf("%T: expected a single write, got %v", writer, bodies)
+		}
+		data := bodies[0]
+		if _, ok := writer.(KVv2Writer); ok {
+			data, _ = data["data"].(map[string]interface{})
+		}
+		if data["keystore"] != base64.StdEncoding.EncodeToString([]byte(binary)) {
+			t.Errorf("%T: expected the keystore to be written base64-encoded, got %v", writer, bodies[0])
+		}
+	}
+}
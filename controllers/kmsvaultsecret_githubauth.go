@@ -3,6 +3,8 @@ package controllers
 import (
 	"errors"
 	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
 )
 
 const (
@@ -11,7 +13,7 @@ const (
 
 type VaultGitHubAuth struct{}
 
-func (auth VaultGitHubAuth) login() error {
+func (auth VaultGitHubAuth) login(vaultClient *vaultapi.Client) error {
 	githubToken, ok := os.LookupEnv("VAULT_GITHUB_TOKEN")
 	if !ok {
 		return errors.New("Environment variable VAULT_GITHUB_TOKEN not set")
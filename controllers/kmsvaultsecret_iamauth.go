@@ -5,6 +5,8 @@ import (
 	"os"
 
 	awsauth "github.com/hashicorp/go-secure-stdlib/awsutil"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/patoarvizu/kms-vault-operator/pkg/logging"
 )
 
 const (
@@ -13,8 +15,8 @@ const (
 
 type VaultIAMAuth struct{}
 
-func (auth VaultIAMAuth) login() error {
-	logger := log.WithValues("Auth", "IAM")
+func (auth VaultIAMAuth) login(vaultClient *vaultapi.Client) error {
+	logger := log.WithValues(logging.AuthMethodKey, AWSIAMAuthenticationMethod)
 	authIAMAWSAccessKeyId, ok := os.LookupEnv("VAULT_IAM_AWS_ACCESS_KEY_ID")
 	if !ok {
 		logger.Info("Environment variable VAULT_IAM_AWS_ACCESS_KEY_ID not set, using default credential chain")
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/validation"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NeverSyncInterval is the spec.syncInterval of objects that are only synced when they change.
+const NeverSyncInterval string = validation.NeverSyncInterval
+
+// syncInterval returns the amount of time to wait before syncing instance again, which is its spec.syncInterval
+// within the operator limits, or --sync-period-seconds if it's not set. It returns 0 if the object shouldn't be synced
+// again until it changes.
+func syncInterval(instance *k8sv1alpha1.KMSVaultSecret) (time.Duration, error) {
+	interval := time.Second * time.Duration(SyncPeriodSeconds)
+	if len(instance.Spec.SyncInterval) > 0 {
+		var err error
+		interval, err = validation.SyncInterval(instance.Spec.SyncInterval)
+		if err != nil {
+			return 0, err
+		}
+		min := time.Second * time.Duration(MinSyncIntervalSeconds)
+		if interval != 0 && interval < min {
+			interval = min
+		}
+	}
+	max := time.Second * time.Duration(MaxSyncIntervalSeconds)
+	if max > 0 && (interval == 0 || interval > max) {
+		interval = max
+	}
+	return interval, nil
+}
+
+// withJitter adds a random amount of time of up to --sync-jitter-percent of interval, so that objects that were
+// synced at the same time (e.g. when the operator starts) don't stay synchronized.
+func withJitter(interval time.Duration) time.Duration {
+	jitter := int64(interval) * int64(SyncJitterPercent) / 100
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(jitter+1))
+}
+
+// nextSync returns the result of a reconcile that syncs instance again after its sync interval, with jitter.
+func nextSync(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret) reconcile.Result {
+	interval, err := syncInterval(instance)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "Invalid sync interval, using --sync-period-seconds instead")
+		interval = time.Second * time.Duration(SyncPeriodSeconds)
+	}
+	if interval == 0 {
+		return reconcile.Result{}
+	}
+	return reconcile.Result{RequeueAfter: withJitter(interval)}
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+)
+
+func TestSyncInterval(t *testing.T) {
+	defer func(period, min, max int) {
+		SyncPeriodSeconds, MinSyncIntervalSeconds, MaxSyncIntervalSeconds = period, min, max
+	}(SyncPeriodSeconds, MinSyncIntervalSeconds, MaxSyncIntervalSeconds)
+	SyncPeriodSeconds = 120
+	MinSyncIntervalSeconds = 30
+	for _, tc := range []struct {
+		syncInterval string
+		max          int
+		expected     time.Duration
+	}{
+		{"", 0, 2 * time.Minute},
+		{"1h30m", 0, 90 * time.Minute},
+		{"1s", 0, 30 * time.Second},
+		{"never", 0, 0},
+		{"never", 3600, time.Hour},
+		{"2h", 3600, time.Hour},
+		{"10m", 3600, 10 * time.Minute},
+	} {
+		MaxSyncIntervalSeconds = tc.max
+		interval, err := syncInterval(&k8sv1alpha1.KMSVaultSecret{Spec: k8sv1alpha1.KMSVaultSecretSpec{SyncInterval: tc.syncInterval}})
+		if err != nil {
+			t.Errorf("%q: %v", tc.syncInterval, err)
+		} else if interval != tc.expected {
+			t.Errorf("%q with a maximum of %ds: expected %v, got %v", tc.syncInterval, tc.max, tc.expected, interval)
+		}
+	}
+	for _, invalid := range []string{"0s", "-1m", "1x", "9999999999h"} {
+		if _, err := syncInterval(&k8sv1alpha1.KMSVaultSecret{Spec: k8sv1alpha1.KMSVaultSecretSpec{SyncInterval: invalid}}); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	defer func(percent int) { SyncJitterPercent = percent }(SyncJitterPercent)
+	SyncJitterPercent = 10
+	for i := 0; i < 100; i++ {
+		if d := withJitter(time.Minute); d < time.Minute || d > time.Minute+6*time.Second {
+			t.Fatalf("Expected a duration between 1m and 1m6s, got %v", d)
+		}
+	}
+	SyncJitterPercent = 0
+	if d := withJitter(time.Minute); d != time.Minute {
+		t.Errorf("Expected no jitter, got %v", d)
+	}
+}
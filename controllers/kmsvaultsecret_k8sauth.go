@@ -3,11 +3,13 @@ package controllers
 import (
 	"io/ioutil"
 	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
 )
 
 type VaultK8sAuth struct{}
 
-func (auth VaultK8sAuth) login() error {
+func (auth VaultK8sAuth) login(vaultClient *vaultapi.Client) error {
 	var vaultK8sRole string
 	vaultK8sRole, roleSet := os.LookupEnv("VAULT_K8S_ROLE")
 	if !roleSet {
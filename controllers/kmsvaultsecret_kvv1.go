@@ -1,25 +1,36 @@
 package controllers
 
 import (
+	"context"
+
 	vaultapi "github.com/hashicorp/vault/api"
 	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
 )
 
 type KVv1Writer struct{}
 
-func (KVv1 KVv1Writer) write(secret *k8sv1alpha1.KMSVaultSecret, vaultClient *vaultapi.Client) error {
-	decryptedSecretData, err := decryptSecrets(secret)
+func (w KVv1Writer) write(ctx context.Context, secret *k8sv1alpha1.KMSVaultSecret, path string, options decryptOptions, vaultClient *vaultapi.Client) error {
+	decryptedSecretData, err := decryptSecrets(ctx, secret, options)
 	if err != nil {
 		return err
 	}
-	_, err = vaultClient.Logical().Write(secret.Spec.Path, decryptedSecretData)
-	if err != nil {
+	return vaultRequest(ctx, "Vault.Write", "write", KVv1, path, vaultClient, func(l *vaultapi.Logical) error {
+		_, err := l.Write(path, decryptedSecretData)
 		return err
+	})
+}
+
+func (w KVv1Writer) read(ctx context.Context, path string, vaultClient *vaultapi.Client) (map[string]interface{}, error) {
+	secret, err := readSecret(ctx, KVv1, path, vaultClient)
+	if err != nil || secret == nil {
+		return nil, err
 	}
-	return nil
+	return secret.Data, nil
 }
 
-func (KVv1 KVv1Writer) delete(secret *k8sv1alpha1.KMSVaultSecret, vaultClient *vaultapi.Client) error {
-	_, err := vaultClient.Logical().Delete(secret.Spec.Path)
-	return err
+func (w KVv1Writer) delete(ctx context.Context, path string, vaultClient *vaultapi.Client) error {
+	return vaultRequest(ctx, "Vault.Delete", "delete", KVv1, path, vaultClient, func(l *vaultapi.Logical) error {
+		_, err := l.Delete(path)
+		return err
+	})
 }
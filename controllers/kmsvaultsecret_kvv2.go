@@ -1,18 +1,20 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"strings"
 
 	vaultapi "github.com/hashicorp/vault/api"
 	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
 )
 
 type KVv2Writer struct{}
 
-func (KVv2 KVv2Writer) write(secret *k8sv1alpha1.KMSVaultSecret, vaultClient *vaultapi.Client) error {
-	read, _ := vaultClient.Logical().Read(secret.Spec.Path)
+func (w KVv2Writer) write(ctx context.Context, secret *k8sv1alpha1.KMSVaultSecret, path string, options decryptOptions, vaultClient *vaultapi.Client) error {
+	read, _ := tracing.VaultClient(ctx, vaultClient).Logical().Read(path)
 	if read != nil {
 		metadata := read.Data["metadata"].(map[string]interface{})
 		version, err := metadata["version"].(json.Number).Int64()
@@ -20,13 +22,13 @@ func (KVv2 KVv2Writer) write(secret *k8sv1alpha1.KMSVaultSecret, vaultClient *va
 			return errors.New("Can't parse secret metadata")
 		}
 		if secret.Spec.KVSettings.CASIndex+1 < int(version) {
-			return errors.New("CAS index is lower than the latest version")
+			return terminalErr(errors.New("CAS index is lower than the latest version"))
 		}
 		if secret.Spec.KVSettings.CASIndex+1 == int(version) {
 			return nil
 		}
 	}
-	decryptedSecretData, err := decryptSecrets(secret)
+	decryptedSecretData, err := decryptSecrets(ctx, secret, options)
 	if err != nil {
 		return err
 	}
@@ -36,15 +38,49 @@ func (KVv2 KVv2Writer) write(secret *k8sv1alpha1.KMSVaultSecret, vaultClient *va
 			"cas": secret.Spec.KVSettings.CASIndex,
 		},
 	}
-	_, err = vaultClient.Logical().Write(secret.Spec.Path, writeData)
-	if err != nil {
+	return vaultRequest(ctx, "Vault.Write", "write", KVv2, path, vaultClient, func(l *vaultapi.Logical) error {
+		_, err := l.Write(path, writeData)
 		return err
+	})
+}
+
+func (w KVv2Writer) read(ctx context.Context, path string, vaultClient *vaultapi.Client) (map[string]interface{}, error) {
+	secret, err := readSecret(ctx, KVv2, path, vaultClient)
+	if err != nil || secret == nil {
+		return nil, err
 	}
-	return nil
+	// The data of a deleted version is null.
+	data, _ := secret.Data["data"].(map[string]interface{})
+	return data, nil
+}
+
+func (w KVv2Writer) delete(ctx context.Context, path string, vaultClient *vaultapi.Client) error {
+	deletePath := metadataPath(ctx, path, vaultClient)
+	return vaultRequest(ctx, "Vault.Delete", "delete", KVv2, deletePath, vaultClient, func(l *vaultapi.Logical) error {
+		_, err := l.Delete(deletePath)
+		return err
+	})
 }
 
-func (KVv2 KVv2Writer) delete(secret *k8sv1alpha1.KMSVaultSecret, vaultClient *vaultapi.Client) error {
-	deletePath := strings.Replace(secret.Spec.Path, "secret/data/", "secret/metadata/", 1)
-	_, err := vaultClient.Logical().Delete(deletePath)
-	return err
+// metadataPath returns the path of the metadata of the secret at the data path path, which has data/ replaced with
+// metadata/ right after the path of the mount. The mount is looked up in Vault, and if it can't be, the first data/
+// segment is replaced instead.
+func metadataPath(ctx context.Context, path string, vaultClient *vaultapi.Client) string {
+	path = strings.Trim(path, "/")
+	mount, err := tracing.VaultClient(ctx, vaultClient).Logical().Read("sys/internal/ui/mounts/" + path)
+	if err == nil && mount != nil {
+		mountPath, _ := mount.Data["path"].(string)
+		dataPrefix := strings.Trim(mountPath, "/") + "/data/"
+		if len(mountPath) > 0 && strings.HasPrefix(path, dataPrefix) {
+			return strings.Trim(mountPath, "/") + "/metadata/" + strings.TrimPrefix(path, dataPrefix)
+		}
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "data" {
+			segments[i] = "metadata"
+			break
+		}
+	}
+	return strings.Join(segments, "/")
 }
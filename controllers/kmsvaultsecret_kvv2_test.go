@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+func TestMetadataPath(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/")
+		switch {
+		case strings.HasPrefix(path, "team-a/kv/"):
+			fmt.Fprint(w, `{"data": {"path": "team-a/kv/", "type": "kv", "options": {"version": "2"}}}`)
+		case strings.HasPrefix(path, "data/"):
+			fmt.Fprint(w, `{"data": {"path": "data/", "type": "kv", "options": {"version": "2"}}}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer vault.Close()
+	c, err := vaultapi.NewClient(&vaultapi.Config{Address: vault.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken("test")
+	c.SetMaxRetries(0)
+	for path, expected := range map[string]string{
+		"team-a/kv/data/app":        "team-a/kv/metadata/app",
+		"/team-a/kv/data/data/app/": "team-a/kv/metadata/data/app",
+		"data/data/app":             "data/metadata/app",
+		"secret/data/app":           "secret/metadata/app",
+		"kv/app/data/db":            "kv/app/metadata/db",
+	} {
+		if actual := metadataPath(context.Background(), path, c); actual != expected {
+			t.Errorf("Expected the metadata path of %s to be %s, got %s", path, expected, actual)
+		}
+	}
+}
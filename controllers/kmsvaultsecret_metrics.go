@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	syncErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kms_vault_operator_sync_errors_total",
+			Help: "Number of failed KMSVaultSecret syncs, by error class",
+		},
+		[]string{"class"},
+	)
+	plaintextCacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kms_vault_operator_plaintext_cache_requests_total",
+			Help: "Number of lookups on the decrypted values cache, by result (hit or miss)",
+		},
+		[]string{"result"},
+	)
+	vaultRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kms_vault_operator_vault_requests_total",
+			Help: "Number of requests to write or delete secrets in Vault, by operation, KV engine version and status (success, the HTTP status code, or error)",
+		},
+		[]string{"operation", "engine", "status"},
+	)
+	vaultRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kms_vault_operator_vault_request_duration_seconds",
+			Help:    "Latency of requests to write or delete secrets in Vault, by operation and KV engine version",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation", "engine"},
+	)
+	vaultAuthAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kms_vault_operator_vault_auth_attempts_total",
+			Help: "Number of Vault logins and token renewals, by authentication method and operation (login or renew)",
+		},
+		[]string{"method", "operation"},
+	)
+	vaultAuthFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kms_vault_operator_vault_auth_failures_total",
+			Help: "Number of failed Vault logins and token renewals, by authentication method and operation (login or renew)",
+		},
+		[]string{"method", "operation"},
+	)
+	vaultTokenTTL = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "kms_vault_operator_vault_token_ttl_seconds",
+			Help: "Seconds until the Vault token expires, as of the last time it was looked up, +Inf if it doesn't expire",
+		},
+		tokenTTL,
+	)
+	kmsMetrics = kmsutil.NewDecryptMetrics("operator")
+	syncStates = newSyncStateCollector()
+)
+
+func init() {
+	metrics.Registry.MustRegister(syncErrors, plaintextCacheRequests, vaultRequests, vaultRequestDuration, vaultAuthAttempts, vaultAuthFailures, vaultTokenTTL, syncStates)
+	metrics.Registry.MustRegister(kmsMetrics.Collectors()...)
+}
+
+var tokenExpiryLock sync.Mutex
+var tokenExpiry time.Time
+
+// recordTokenTTL records when the token of secret, the response of a token lookup or renewal, expires.
+func recordTokenTTL(secret *vaultapi.Secret) {
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return
+	}
+	tokenExpiryLock.Lock()
+	defer tokenExpiryLock.Unlock()
+	if ttl == 0 {
+		tokenExpiry = time.Time{}
+		return
+	}
+	tokenExpiry = time.Now().Add(ttl)
+}
+
+func tokenTTL() float64 {
+	tokenExpiryLock.Lock()
+	defer tokenExpiryLock.Unlock()
+	if tokenExpiry.IsZero() {
+		return math.Inf(1)
+	}
+	return math.Max(0, time.Until(tokenExpiry).Seconds())
+}
+
+// observeVaultRequest records a Vault request that started at start and returned err.
+func observeVaultRequest(operation string, engine string, start time.Time, err error) {
+	vaultRequestDuration.WithLabelValues(operation, engine).Observe(time.Since(start).Seconds())
+	status := "success"
+	var responseErr *vaultapi.ResponseError
+	if errors.As(err, &responseErr) {
+		status = strconv.Itoa(responseErr.StatusCode)
+	} else if err != nil {
+		status = "error"
+	}
+	vaultRequests.WithLabelValues(operation, engine, status).Inc()
+}
+
+// syncState is the last known Synced condition of a KMSVaultSecret, and when it was last synced successfully, since
+// the operator started or as of its Synced condition.
+type syncState struct {
+	status      string
+	reason      string
+	lastSuccess time.Time
+}
+
+// syncStateCollector exports the number of KMSVaultSecrets by Synced condition, and the seconds since each of them
+// was last synced successfully. It's computed from the objects reconciled since the operator started.
+type syncStateCollector struct {
+	lock          sync.Mutex
+	states        map[types.NamespacedName]syncState
+	secrets       *prometheus.Desc
+	sinceLastSync *prometheus.Desc
+}
+
+func newSyncStateCollector() *syncStateCollector {
+	return &syncStateCollector{
+		states:        map[types.NamespacedName]syncState{},
+		secrets:       prometheus.NewDesc("kms_vault_operator_secrets", "Number of KMSVaultSecrets, by the status and reason of their Synced condition", []string{"status", "reason"}, nil),
+		sinceLastSync: prometheus.NewDesc("kms_vault_operator_seconds_since_last_successful_sync", "Seconds since each KMSVaultSecret was last written to Vault successfully", []string{"namespace", "name"}, nil),
+	}
+}
+
+// observe records the Synced condition of instance, and that it was just synced successfully if synced is true. The
+// first time a secret with a True Synced condition is observed, its last successful sync is seeded from the condition.
+func (c *syncStateCollector) observe(instance *k8sv1alpha1.KMSVaultSecret, synced bool) {
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	state := c.states[key]
+	state.status, state.reason = "Unknown", ""
+	if condition := meta.FindStatusCondition(instance.Status.Conditions, SyncedCondition); condition != nil {
+		state.status, state.reason = string(condition.Status), condition.Reason
+		// A secret that was already synced before the operator started was last synced successfully no earlier
+		// than when its condition became True.
+		if state.lastSuccess.IsZero() && condition.Status == metav1.ConditionTrue {
+			state.lastSuccess = condition.LastTransitionTime.Time
+		}
+	}
+	if synced {
+		state.lastSuccess = time.Now()
+	}
+	c.states[key] = state
+}
+
+func (c *syncStateCollector) forget(key types.NamespacedName) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.states, key)
+}
+
+func (c *syncStateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.secrets
+	ch <- c.sinceLastSync
+}
+
+func (c *syncStateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	counts := map[[2]string]int{}
+	for key, state := range c.states {
+		counts[[2]string{state.status, state.reason}]++
+		if !state.lastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(c.sinceLastSync, prometheus.GaugeValue, time.Since(state.lastSuccess).Seconds(), key.Namespace, key.Name)
+		}
+	}
+	for labels, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.secrets, prometheus.GaugeValue, float64(count), labels[0], labels[1])
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func syncedSecret(name string, status metav1.ConditionStatus, reason string) *k8sv1alpha1.KMSVaultSecret {
+	instance := &k8sv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{Type: SyncedCondition, Status: status, Reason: reason})
+	return instance
+}
+
+func TestSyncStateCollector(t *testing.T) {
+	c := newSyncStateCollector()
+	c.observe(syncedSecret("a", metav1.ConditionTrue, "Synced"), true)
+	c.observe(syncedSecret("b", metav1.ConditionTrue, "Synced"), true)
+	c.observe(syncedSecret("c", metav1.ConditionFalse, PolicyViolationReason), false)
+	c.observe(&k8sv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "d"}}, false)
+	// A failed sync keeps the time of the last successful one.
+	c.observe(syncedSecret("b", metav1.ConditionFalse, "RetryableError"), false)
+	c.forget(types.NamespacedName{Namespace: "default", Name: "a"})
+
+	expected := `
+# HELP kms_vault_operator_secrets Number of KMSVaultSecrets, by the status and reason of their Synced condition
+# TYPE kms_vault_operator_secrets gauge
+kms_vault_operator_secrets{reason="",status="Unknown"} 1
+kms_vault_operator_secrets{reason="PolicyViolation",status="False"} 1
+kms_vault_operator_secrets{reason="RetryableError",status="False"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "kms_vault_operator_secrets"); err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(c, "kms_vault_operator_seconds_since_last_successful_sync"); count != 1 {
+		t.Errorf("Expected the time since the last successful sync of 1 object, got %d", count)
+	}
+}
+
+func TestSyncStateCollectorSeedsLastSuccess(t *testing.T) {
+	c := newSyncStateCollector()
+	// Observed before its first sync since the operator started, e.g. after a terminal error with a previous True
+	// condition, or before the sync finished.
+	synced := syncedSecret("a", metav1.ConditionTrue, "Synced")
+	synced.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-10 * time.Minute))
+	c.observe(synced, false)
+	c.observe(syncedSecret("b", metav1.ConditionFalse, "RetryableError"), false)
+	if count := testutil.CollectAndCount(c, "kms_vault_operator_seconds_since_last_successful_sync"); count != 1 {
+		t.Fatalf("Expected the time since the last successful sync of 1 object, got %d", count)
+	}
+	if since := time.Since(c.states[types.NamespacedName{Namespace: "default", Name: "a"}].lastSuccess); since < 10*time.Minute {
+		t.Errorf("Expected the last successful sync to be seeded from the Synced condition, got %v ago", since)
+	}
+	// Seeding doesn't override a sync observed since then.
+	c.observe(synced, true)
+	c.observe(synced, false)
+	if since := time.Since(c.states[types.NamespacedName{Namespace: "default", Name: "a"}].lastSuccess); since > time.Minute {
+		t.Errorf("Expected the last successful sync to be the one just observed, got %v ago", since)
+	}
+}
+
+func TestObserveVaultRequest(t *testing.T) {
+	vaultRequests.Reset()
+	start := time.Now()
+	observeVaultRequest("write", KVv1, start, nil)
+	observeVaultRequest("write", KVv1, start, &vaultapi.ResponseError{StatusCode: 403})
+	observeVaultRequest("delete", KVv2, start, errors.New("connection refused"))
+	for _, tc := range []struct {
+		labels []string
+		count  float64
+	}{
+		{[]string{"write", KVv1, "success"}, 1},
+		{[]string{"write", KVv1, "403"}, 1},
+		{[]string{"delete", KVv2, "error"}, 1},
+	} {
+		if count := testutil.ToFloat64(vaultRequests.WithLabelValues(tc.labels...)); count != tc.count {
+			t.Errorf("Expected %v requests for %v, got %v", tc.count, tc.labels, count)
+		}
+	}
+}
+
+func TestTokenTTL(t *testing.T) {
+	defer func() { tokenExpiry = time.Time{} }()
+	recordTokenTTL(&vaultapi.Secret{Data: map[string]interface{}{"ttl": "3600"}})
+	if ttl := tokenTTL(); ttl < 3500 || ttl > 3600 {
+		t.Errorf("Expected a TTL of about an hour, got %v", ttl)
+	}
+	recordTokenTTL(&vaultapi.Secret{Data: map[string]interface{}{"ttl": "0"}})
+	if ttl := tokenTTL(); !math.IsInf(ttl, 1) {
+		t.Errorf("Expected a token that doesn't expire to have an infinite TTL, got %v", ttl)
+	}
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/logging"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// deleted deletes the secret that a deleted object last wrote, and removes its delete finalizer. Nothing is deleted if
+// the object never wrote a secret, or if the path it wrote to isn't allowed by the KMSVaultPolicies anymore. The
+// dry-run annotation doesn't apply to deletions, since the secret was written before it was set.
+func (r *KMSVaultSecretReconciler) deleted(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret) (ctrl.Result, error) {
+	reqLogger := logf.FromContext(ctx)
+	path := writtenPath(instance)
+	if len(path) > 0 {
+		target, err := deletionTarget(instance, path)
+		if err != nil {
+			reqLogger.Error(err, "Error rendering path prefix")
+			return r.syncFailed(ctx, instance, err)
+		}
+		decision, err := policy.Evaluate(ctx, r.Client, target)
+		if err != nil {
+			reqLogger.Error(err, "Error evaluating KMSVaultPolicies")
+			return r.syncFailed(ctx, instance, err)
+		}
+		if !decision.Allowed {
+			reqLogger.Info("Deleting the secret is not allowed by KMSVaultPolicies, leaving it in place", logging.PathKey, path, "reason", decision.Message)
+			rec.Event(instance, corev1.EventTypeWarning, PolicyViolationReason, fmt.Sprintf("%s, the secret at %s was left in place", decision.Message, path))
+		} else {
+			err = kvWriter(previousEngineVersion(instance)).delete(ctx, path, getVaultClient())
+			if err != nil {
+				reqLogger.Error(err, "Error deleting secret from Vault", logging.PathKey, path, logging.EngineKey, previousEngineVersion(instance))
+				return r.syncFailed(ctx, instance, err)
+			}
+		}
+	}
+	instance.Finalizers = removeFinalizer(instance.Finalizers, DeletedFinalizer)
+	r.Client.Update(ctx, instance)
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	retries.reset(key)
+	syncStates.forget(key)
+	return reconcile.Result{}, nil
+}
+
+// writtenPath returns the path that instance last wrote its secret to, or an empty string if it never wrote one.
+// Objects written by versions of the operator that didn't record the path are assumed to have written to their
+// current one.
+func writtenPath(instance *k8sv1alpha1.KMSVaultSecret) string {
+	if len(instance.Status.Path) > 0 || !instance.Status.Created {
+		return instance.Status.Path
+	}
+	path, err := policy.RenderPath(instance.Spec.Path, instance)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// cleanUpPreviousPath handles a secret that was last written to a different path than path. If the object has the
+// delete finalizer, the previous location is deleted (with the writer of the engine version it was written with),
+// otherwise it's left in place, the same way it would be if the object was deleted. Like on deletion, it's also left
+// in place if the KMSVaultPolicies don't allow it anymore.
+func (r *KMSVaultSecretReconciler) cleanUpPreviousPath(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret, path string) error {
+	previousPath := instance.Status.Path
+	if len(previousPath) == 0 || previousPath == path {
+		return nil
+	}
+	if !controllerutil.ContainsFinalizer(instance, DeletedFinalizer) {
+		rec.Event(instance, corev1.EventTypeNormal, "SecretMoved", fmt.Sprintf("Secret moved from %s to %s, the previous location was left in place", previousPath, path))
+		return nil
+	}
+	target, err := deletionTarget(instance, previousPath)
+	if err != nil {
+		return err
+	}
+	decision, err := policy.Evaluate(ctx, r.Client, target)
+	if err != nil {
+		return err
+	}
+	if !decision.Allowed {
+		logf.FromContext(ctx).Info("Deleting the previous secret is not allowed by KMSVaultPolicies, leaving it in place", logging.PathKey, previousPath, "reason", decision.Message)
+		rec.Event(instance, corev1.EventTypeWarning, PolicyViolationReason, fmt.Sprintf("%s, the previous location %s of the secret was left in place", decision.Message, previousPath))
+		return nil
+	}
+	err = kvWriter(previousEngineVersion(instance)).delete(ctx, previousPath, getVaultClient())
+	if err != nil {
+		return fmt.Errorf("Error deleting secret from previous path %s: %w", previousPath, err)
+	}
+	rec.Event(instance, corev1.EventTypeNormal, "SecretMoved", fmt.Sprintf("Secret moved from %s to %s, the previous location was deleted", previousPath, path))
+	return nil
+}
+
+// previousEngineVersion returns the KV engine version that the secret was last written with. Objects last written by
+// versions of the operator that didn't record it are assumed to have used the current one.
+func previousEngineVersion(instance *k8sv1alpha1.KMSVaultSecret) string {
+	if len(instance.Status.EngineVersion) > 0 {
+		return instance.Status.EngineVersion
+	}
+	return engineVersion(instance)
+}
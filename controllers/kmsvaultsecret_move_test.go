@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// fakeVault replaces the Vault client with one for a server that accepts any request, and returns the requests that it
+// receives, as the method followed by the path.
+func fakeVault(t *testing.T) func() []string {
+	var lock sync.Mutex
+	requests := []string{}
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(vault.Close)
+	c, err := vaultapi.NewClient(&vaultapi.Config{Address: vault.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken("test")
+	vaultClient = c
+	return func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, requests...)
+	}
+}
+
+func fakeReconciler(t *testing.T, objects ...client.Object) *KMSVaultSecretReconciler {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := k8sv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &KMSVaultSecretReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		Scheme: scheme,
+	}
+}
+
+func deletedSecret(status k8sv1alpha1.KMSVaultSecretStatus) *k8sv1alpha1.KMSVaultSecret {
+	now := metav1.Now()
+	return &k8sv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "app", DeletionTimestamp: &now, Finalizers: []string{DeletedFinalizer}},
+		Spec:       k8sv1alpha1.KMSVaultSecretSpec{Path: "secret/team-a/{{ .Name }}"},
+		Status:     status,
+	}
+}
+
+func TestDeleted(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}}
+	teamPolicy := &k8sv1alpha1.KMSVaultPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+		Spec: k8sv1alpha1.KMSVaultPolicySpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			AllowedPaths:      []string{"secret/team-a/*"},
+		},
+	}
+	defer func() { PathPrefixTemplate = "" }()
+	for name, tc := range map[string]struct {
+		status   k8sv1alpha1.KMSVaultSecretStatus
+		prefix   string
+		policies bool
+		dryRun   bool
+		expected []string
+	}{
+		"never written":        {k8sv1alpha1.KMSVaultSecretStatus{}, "", false, false, []string{}},
+		"written":              {k8sv1alpha1.KMSVaultSecretStatus{Created: true, Path: "secret/team-a/app"}, "", false, false, []string{"DELETE /v1/secret/team-a/app"}},
+		"written before moved": {k8sv1alpha1.KMSVaultSecretStatus{Created: true, Path: "secret/team-a/old"}, "", true, false, []string{"DELETE /v1/secret/team-a/old"}},
+		"path not recorded":    {k8sv1alpha1.KMSVaultSecretStatus{Created: true}, "", false, false, []string{"DELETE /v1/secret/team-a/app"}},
+		"not allowed":          {k8sv1alpha1.KMSVaultSecretStatus{Created: true, Path: "secret/team-b/app"}, "", true, false, []string{}},
+		"dry run":              {k8sv1alpha1.KMSVaultSecretStatus{Created: true, Path: "secret/team-a/app"}, "", false, true, []string{"DELETE /v1/secret/team-a/app"}},
+		"outside of prefix":    {k8sv1alpha1.KMSVaultSecretStatus{Created: true, Path: "secret/team-b/app"}, "secret/{{ .Namespace }}", false, false, []string{}},
+	} {
+		requests := fakeVault(t)
+		recorder := record.NewFakeRecorder(10)
+		rec = recorder
+		PathPrefixTemplate = tc.prefix
+		instance := deletedSecret(tc.status)
+		if tc.dryRun {
+			instance.Annotations = map[string]string{DryRunAnnotation: "true"}
+		}
+		objects := []client.Object{namespace, instance}
+		if tc.policies {
+			objects = append(objects, teamPolicy)
+		}
+		r := fakeReconciler(t, objects...)
+		_, err := r.deleted(context.Background(), instance)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if strings.Join(requests(), ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%s: expected Vault requests %v, got %v", name, tc.expected, requests())
+		}
+		if controllerutil.ContainsFinalizer(instance, DeletedFinalizer) {
+			t.Errorf("%s: expected the finalizer to be removed", name)
+		}
+		if len(tc.expected) == 0 && len(tc.status.Path) > 0 {
+			select {
+			case event := <-recorder.Events:
+				if !strings.Contains(event, PolicyViolationReason) || !strings.Contains(event, "left in place") {
+					t.Errorf("%s: expected a policy violation event, got %q", name, event)
+				}
+			default:
+				t.Errorf("%s: expected an event for the secret that was left in place", name)
+			}
+		}
+	}
+}
+
+func TestCleanUpPreviousPath(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"team": "a"}}}
+	teamPolicy := &k8sv1alpha1.KMSVaultPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+		Spec: k8sv1alpha1.KMSVaultPolicySpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			AllowedPaths:      []string{"secret/new"},
+		},
+	}
+	for name, tc := range map[string]struct {
+		status     k8sv1alpha1.KMSVaultSecretStatus
+		finalizers []string
+		policies   bool
+		expected   []string
+		event      string
+	}{
+		"never written":            {k8sv1alpha1.KMSVaultSecretStatus{}, []string{DeletedFinalizer}, false, []string{}, ""},
+		"same path":                {k8sv1alpha1.KMSVaultSecretStatus{Path: "secret/new"}, []string{DeletedFinalizer}, false, []string{}, ""},
+		"moved without finalizer":  {k8sv1alpha1.KMSVaultSecretStatus{Path: "secret/old"}, nil, false, []string{}, "SecretMoved"},
+		"moved":                    {k8sv1alpha1.KMSVaultSecretStatus{Path: "secret/old"}, []string{DeletedFinalizer}, false, []string{"DELETE /v1/secret/old"}, "SecretMoved"},
+		"moved from v2":            {k8sv1alpha1.KMSVaultSecretStatus{Path: "kv/data/old", EngineVersion: KVv2}, []string{DeletedFinalizer}, false, []string{"GET /v1/sys/internal/ui/mounts/kv/data/old", "DELETE /v1/kv/metadata/old"}, "SecretMoved"},
+		"moved from a denied path": {k8sv1alpha1.KMSVaultSecretStatus{Path: "secret/old"}, []string{DeletedFinalizer}, true, []string{}, PolicyViolationReason},
+	} {
+		requests := fakeVault(t)
+		recorder := record.NewFakeRecorder(10)
+		rec = recorder
+		instance := &k8sv1alpha1.KMSVaultSecret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Finalizers: tc.finalizers},
+			Status:     tc.status,
+		}
+		objects := []client.Object{namespace}
+		if tc.policies {
+			objects = append(objects, teamPolicy)
+		}
+		err := fakeReconciler(t, objects...).cleanUpPreviousPath(context.Background(), instance, "secret/new")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if strings.Join(requests(), ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%s: expected Vault requests %v, got %v", name, tc.expected, requests())
+		}
+		select {
+		case event := <-recorder.Events:
+			if len(tc.event) == 0 || !strings.Contains(event, tc.event) {
+				t.Errorf("%s: unexpected event %q", name, event)
+			}
+		default:
+			if len(tc.event) > 0 {
+				t.Errorf("%s: expected a %s event", name, tc.event)
+			}
+		}
+	}
+}
+
+func TestCleanUpPreviousPathFailure(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer vault.Close()
+	c, err := vaultapi.NewClient(&vaultapi.Config{Address: vault.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetMaxRetries(0)
+	vaultClient = c
+	rec = record.NewFakeRecorder(10)
+	instance := &k8sv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Finalizers: []string{DeletedFinalizer}},
+		Status:     k8sv1alpha1.KMSVaultSecretStatus{Path: "secret/old"},
+	}
+	r := fakeReconciler(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})
+	err = r.cleanUpPreviousPath(context.Background(), instance, "secret/new")
+	if err == nil || classifyError(err) != RetryableError {
+		t.Errorf("Expected a retryable error when the previous path can't be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const PolicyViolationReason string = "PolicyViolation"
+
+// policyTarget is the target of writing the secret of instance, as the validating webhook evaluates it.
+func policyTarget(instance *k8sv1alpha1.KMSVaultSecret) (policy.Target, error) {
+	target, err := policy.SecretTarget(instance, PathPrefixTemplate)
+	if err != nil {
+		return policy.Target{}, terminalErr(err)
+	}
+	return target, nil
+}
+
+// deletionTarget is the target of deleting the secret that instance last wrote to path. It doesn't depend on the
+// current spec, other than for the path prefix, and no role is assumed to delete it.
+func deletionTarget(instance *k8sv1alpha1.KMSVaultSecret, path string) (policy.Target, error) {
+	prefix, err := pathPrefix(instance)
+	if err != nil {
+		return policy.Target{}, err
+	}
+	return policy.Target{
+		Namespace:     instance.Namespace,
+		Path:          path,
+		PathPrefix:    prefix,
+		EngineVersion: previousEngineVersion(instance),
+	}, nil
+}
+
+func pathPrefix(instance *k8sv1alpha1.KMSVaultSecret) (string, error) {
+	prefix, err := policy.PathPrefix(PathPrefixTemplate, instance)
+	if err != nil {
+		return "", terminalErr(err)
+	}
+	return prefix, nil
+}
+
+// policyViolation reports that the object is not allowed by the KMSVaultPolicies that apply to it. Since the policies
+// can change independently of the object, it's checked again on the next sync period instead of being treated as a
+// terminal error.
+func (r *KMSVaultSecretReconciler) policyViolation(ctx context.Context, instance *k8sv1alpha1.KMSVaultSecret, message string) (ctrl.Result, error) {
+	syncErrors.WithLabelValues(PolicyViolationReason).Inc()
+	rec.Event(instance, corev1.EventTypeWarning, PolicyViolationReason, message)
+	r.updateSyncedCondition(ctx, instance, metav1.ConditionFalse, PolicyViolationReason, message)
+	return nextSync(ctx, instance), nil
+}
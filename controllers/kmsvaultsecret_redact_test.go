@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/redact"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// decryptWithCapturedOutput runs decryptSecrets on each secret of secret on its own, since a secret that can't be
+// decoded or decrypted fails the whole sync, and returns what was logged, and the recorded events and errors.
+func decryptWithCapturedOutput(t *testing.T, secret *k8sv1alpha1.KMSVaultSecret) (string, string) {
+	var err error
+	kmsClients, err = kmsutil.NewClientCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmsClients.SetClient(kmsutil.ClientConfig{}, fakeKMS{plaintexts: map[string]string{testCiphertext: testPlaintext}})
+	recorder := record.NewFakeRecorder(100)
+	rec = recorder
+	output := &bytes.Buffer{}
+	ctx := logf.IntoContext(context.Background(), zap.New(zap.WriteTo(output), zap.UseDevMode(true)))
+
+	errs := []string{}
+	for _, s := range secret.Spec.Secrets {
+		single := secret.DeepCopy()
+		single.Spec.Secrets = []k8sv1alpha1.Secret{s}
+		data, err := decryptSecrets(ctx, single, decryptOptions{})
+		if s.Key == "password" && (err != nil || data["password"] != testPlaintext) {
+			t.Fatalf("Expected the valid secret to be decrypted, got %v, %v", data, err)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	close(recorder.Events)
+	events := []string{}
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+	return output.String(), strings.Join(append(events, errs...), "\n")
+}
+
+func redactionTestSecret() *k8sv1alpha1.KMSVaultSecret {
+	return &k8sv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: k8sv1alpha1.KMSVaultSecretSpec{
+			Secrets: []k8sv1alpha1.Secret{
+				{Key: "password", EncryptedSecret: base64.StdEncoding.EncodeToString([]byte(testCiphertext))},
+				{Key: "empty", EmptySecret: true, EncryptedSecret: base64.StdEncoding.EncodeToString([]byte("ignored-ciphertext"))},
+				{Key: "undecodable", EncryptedSecret: "undecodable-ciphertext!"},
+				{Key: "undecryptable", EncryptedSecret: base64.StdEncoding.EncodeToString([]byte("undecryptable-ciphertext"))},
+			},
+		},
+	}
+}
+
+func TestDecryptSecretsRedactsLogsAndEvents(t *testing.T) {
+	secret := redactionTestSecret()
+	logs, events := decryptWithCapturedOutput(t, secret)
+
+	for _, output := range []string{logs, events} {
+		if strings.Contains(output, testPlaintext) {
+			t.Errorf("Plaintext found in output:\n%s", output)
+		}
+		for _, s := range secret.Spec.Secrets {
+			if strings.Contains(output, s.EncryptedSecret) {
+				t.Errorf("Ciphertext of key %s found in output:\n%s", s.Key, output)
+			}
+		}
+	}
+	for _, s := range secret.Spec.Secrets[1:] {
+		if !strings.Contains(logs, redact.Fingerprint(s.EncryptedSecret)) {
+			t.Errorf("Expected the fingerprint of key %s in the logs, got:\n%s", s.Key, logs)
+		}
+	}
+}
+
+func TestDecryptSecretsRevealsOnlyCiphertexts(t *testing.T) {
+	redact.RevealCiphertexts = true
+	defer func() { redact.RevealCiphertexts = false }()
+	secret := redactionTestSecret()
+	logs, events := decryptWithCapturedOutput(t, secret)
+
+	if strings.Contains(logs, testPlaintext) || strings.Contains(events, testPlaintext) {
+		t.Errorf("Plaintext found in output:\n%s\n%s", logs, events)
+	}
+	if !strings.Contains(logs, secret.Spec.Secrets[2].EncryptedSecret) {
+		t.Errorf("Expected the undecodable ciphertext in the logs, got:\n%s", logs)
+	}
+}
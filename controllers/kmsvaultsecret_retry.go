@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	vaultapi "github.com/hashicorp/vault/api"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type ErrorClass string
+
+const (
+	RetryableError ErrorClass = "RetryableError"
+	TerminalError  ErrorClass = "TerminalError"
+)
+
+// terminalKMSErrorCodes are the KMS error codes that won't go away by retrying the same request, i.e. the ciphertext,
+// the key or the permissions need to change first.
+var terminalKMSErrorCodes = map[string]bool{
+	kms.ErrCodeInvalidCiphertextException: true,
+	kms.ErrCodeIncorrectKeyException:      true,
+	kms.ErrCodeInvalidKeyUsageException:   true,
+	kms.ErrCodeInvalidGrantTokenException: true,
+	kms.ErrCodeNotFoundException:          true,
+	kms.ErrCodeDisabledException:          true,
+	kms.ErrCodeInvalidStateException:      true,
+	"AccessDeniedException":               true,
+	"ValidationException":                 true,
+}
+
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func terminalErr(err error) error {
+	return &classifiedError{class: TerminalError, err: err}
+}
+
+func retryableErr(err error) error {
+	return &classifiedError{class: RetryableError, err: err}
+}
+
+// terminalVaultStatusCodes are the Vault response codes that reject the request itself, e.g. a path that doesn't exist,
+// a CAS mismatch, or a path that the token of the operator is not allowed to write to. A 403 can also come from a
+// token that expired or was revoked mid-write, which syncFailed handles by retrying once after checking the token
+// again.
+var terminalVaultStatusCodes = map[int]bool{
+	http.StatusBadRequest:       true,
+	http.StatusForbidden:        true,
+	http.StatusNotFound:         true,
+	http.StatusMethodNotAllowed: true,
+}
+
+// classifyError decides whether retrying the operation that produced err could succeed without the KMSVaultSecret
+// changing. Errors that can't be classified are assumed to be transient (e.g. network failures).
+func classifyError(err error) ErrorClass {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+	var vaultErr *vaultapi.ResponseError
+	if errors.As(err, &vaultErr) {
+		if terminalVaultStatusCodes[vaultErr.StatusCode] {
+			return TerminalError
+		}
+		return RetryableError
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		if request.IsErrorThrottle(awsErr) || request.IsErrorRetryable(awsErr) {
+			return RetryableError
+		}
+		if terminalKMSErrorCodes[awsErr.Code()] {
+			return TerminalError
+		}
+	}
+	return RetryableError
+}
+
+// isVaultForbidden reports whether err is a 403 from Vault, which can mean that the token of the operator was revoked
+// or expired.
+func isVaultForbidden(err error) bool {
+	var vaultErr *vaultapi.ResponseError
+	return errors.As(err, &vaultErr) && vaultErr.StatusCode == http.StatusForbidden
+}
+
+// retryBackoff keeps track of consecutive retryable failures per object to calculate an exponential delay with jitter.
+// It also keeps track of the objects whose last sync was rejected by Vault with a 403.
+type retryBackoff struct {
+	lock      sync.Mutex
+	failures  map[types.NamespacedName]int
+	forbidden map[types.NamespacedName]bool
+}
+
+var retries = &retryBackoff{failures: map[types.NamespacedName]int{}, forbidden: map[types.NamespacedName]bool{}}
+
+func (b *retryBackoff) next(key types.NamespacedName) time.Duration {
+	b.lock.Lock()
+	attempt := b.failures[key]
+	b.failures[key] = attempt + 1
+	b.lock.Unlock()
+	base := time.Second * time.Duration(RetryBaseDelaySeconds)
+	max := time.Second * time.Duration(RetryMaxDelaySeconds)
+	delay := max
+	if attempt < 32 && base<<uint(attempt) > 0 && base<<uint(attempt) < max {
+		delay = base << uint(attempt)
+	}
+	// "Equal jitter": wait at least half of the delay, plus a random amount up to the other half.
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// forbiddenAgain records that the sync of key was rejected by Vault with a 403, and reports whether the previous one
+// was too.
+func (b *retryBackoff) forbiddenAgain(key types.NamespacedName) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	again := b.forbidden[key]
+	b.forbidden[key] = true
+	return again
+}
+
+func (b *retryBackoff) reset(key types.NamespacedName) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.failures, key)
+	delete(b.forbidden, key)
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	vaultapi "github.com/hashicorp/vault/api"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestClassifyError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err      error
+		expected ErrorClass
+	}{
+		"unknown":                  {errors.New("connection reset"), RetryableError},
+		"terminal":                 {terminalErr(errors.New("invalid")), TerminalError},
+		"wrapped terminal":         {fmt.Errorf("Error writing: %w", terminalErr(errors.New("invalid"))), TerminalError},
+		"retryable over terminal":  {retryableErr(&vaultapi.ResponseError{StatusCode: 400}), RetryableError},
+		"vault 400":                {&vaultapi.ResponseError{StatusCode: 400}, TerminalError},
+		"vault 404":                {&vaultapi.ResponseError{StatusCode: 404}, TerminalError},
+		"vault 405":                {&vaultapi.ResponseError{StatusCode: 405}, TerminalError},
+		"vault 403":                {&vaultapi.ResponseError{StatusCode: 403}, TerminalError},
+		"vault 412":                {&vaultapi.ResponseError{StatusCode: 412}, RetryableError},
+		"vault 429":                {&vaultapi.ResponseError{StatusCode: 429}, RetryableError},
+		"vault 503":                {&vaultapi.ResponseError{StatusCode: 503}, RetryableError},
+		"kms invalid ciphertext":   {awserr.New(kms.ErrCodeInvalidCiphertextException, "", nil), TerminalError},
+		"kms access denied":        {awserr.New("AccessDeniedException", "", nil), TerminalError},
+		"kms throttled":            {awserr.New("ThrottlingException", "", nil), RetryableError},
+		"kms internal":             {awserr.New(kms.ErrCodeInternalException, "", nil), RetryableError},
+		"wrapped kms":              {fmt.Errorf("Error decrypting key a: %w", awserr.New(kms.ErrCodeIncorrectKeyException, "", nil)), TerminalError},
+		"unclassified kms failure": {awserr.New("SomethingNew", "", nil), RetryableError},
+	} {
+		if class := classifyError(tc.err); class != tc.expected {
+			t.Errorf("%s: expected %s, got %s", name, tc.expected, class)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	RetryBaseDelaySeconds = 1
+	RetryMaxDelaySeconds = 8
+	b := &retryBackoff{failures: map[types.NamespacedName]int{}}
+	key := types.NamespacedName{Namespace: "default", Name: "test"}
+	for attempt, expected := range []time.Duration{1, 2, 4, 8, 8, 8} {
+		delay := b.next(key)
+		max := expected * time.Second
+		if delay < max/2 || delay > max {
+			t.Errorf("Attempt %d: expected a delay between %s and %s, got %s", attempt, max/2, max, delay)
+		}
+	}
+	b.reset(key)
+	if delay := b.next(key); delay > time.Second {
+		t.Errorf("Expected the delay to start over after a reset, got %s", delay)
+	}
+}
+
+// decryptSecretsWithKMS decrypts secrets, whose encryptedSecret must already be base64-encoded, with svc.
+func decryptSecretsWithKMS(t *testing.T, svc kmsiface.KMSAPI, options decryptOptions, secrets []k8sv1alpha1.Secret) (map[string]interface{}, error) {
+	var err error
+	kmsClients, err = kmsutil.NewClientCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmsClients.SetClient(kmsutil.ClientConfig{}, svc)
+	rec = record.NewFakeRecorder(100)
+	secret := &k8sv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec:       k8sv1alpha1.KMSVaultSecretSpec{Secrets: secrets},
+	}
+	return decryptSecrets(context.Background(), secret, options)
+}
+
+func TestDecryptSecretsTerminalErrors(t *testing.T) {
+	for name, secret := range map[string]k8sv1alpha1.Secret{
+		"undecodable":   {Key: "password", EncryptedSecret: "undecodable!"},
+		"undecryptable": {Key: "password", EncryptedSecret: "dW5kZWNyeXB0YWJsZQ=="},
+	} {
+		secrets := []k8sv1alpha1.Secret{{Key: "user", EncryptedSecret: "dXNlcg=="}, secret}
+		_, err := decryptSecretsWithKMS(t, fakeKMS{plaintexts: map[string]string{"user": "admin"}}, decryptOptions{}, secrets)
+		if err == nil || classifyError(err) != TerminalError {
+			t.Errorf("%s: expected a terminal error instead of skipping the key, got %v", name, err)
+		}
+	}
+}
+
+func TestDecryptSecretsKeyNotAllowed(t *testing.T) {
+	secrets := []k8sv1alpha1.Secret{{Key: "user", EncryptedSecret: "dXNlcg=="}}
+	svc := fakeKMS{plaintexts: map[string]string{"user": "admin"}}
+	_, err := decryptSecretsWithKMS(t, svc, decryptOptions{allowedKeys: []kmsutil.KeyAllowlist{{"arn:aws:kms:us-east-1:123456789012:key/other"}}}, secrets)
+	if err == nil || classifyError(err) != TerminalError {
+		t.Errorf("Expected a terminal error instead of skipping the key, got %v", err)
+	}
+	data, err := decryptSecretsWithKMS(t, svc, decryptOptions{allowedKeys: []kmsutil.KeyAllowlist{{testKMSKey}}}, secrets)
+	if err != nil || data["user"] != "admin" {
+		t.Errorf("Expected an allowed key to be decrypted, got %v, %v", data, err)
+	}
+}
+
+func TestDecryptSecretsContextNotAllowed(t *testing.T) {
+	svc := fakeKMS{plaintexts: map[string]string{"user": "admin"}}
+	options := decryptOptions{requiredContext: policy.ParseContextRequirements([]string{"app"})}
+	_, err := decryptSecretsWithKMS(t, svc, options, []k8sv1alpha1.Secret{{Key: "user", EncryptedSecret: "dXNlcg=="}})
+	if err == nil || classifyError(err) != TerminalError {
+		t.Errorf("Expected a terminal error instead of skipping the key, got %v", err)
+	}
+	data, err := decryptSecretsWithKMS(t, svc, options, []k8sv1alpha1.Secret{{Key: "user", EncryptedSecret: "dXNlcg==", SecretContext: map[string]string{"app": "api"}}})
+	if err != nil || data["user"] != "admin" {
+		t.Errorf("Expected a secret with the required context to be decrypted, got %v, %v", data, err)
+	}
+}
+
+func TestSyncFailedForbidden(t *testing.T) {
+	rec = record.NewFakeRecorder(10)
+	instance := &k8sv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "forbidden"}}
+	r := fakeReconciler(t, instance)
+	key := types.NamespacedName{Namespace: "default", Name: "forbidden"}
+	defer retries.reset(key)
+	forbidden := fmt.Errorf("Error writing secret: %w", &vaultapi.ResponseError{StatusCode: 403})
+
+	tokenTrustedUntil = time.Now().Add(time.Hour)
+	result, _ := r.syncFailed(context.Background(), instance, forbidden)
+	if result.RequeueAfter == 0 || hasTerminalError(instance) {
+		t.Errorf("Expected the first 403 to be retried, got %+v", result)
+	}
+	if !tokenTrustedUntil.IsZero() {
+		t.Error("Expected the token to be looked up again after a 403")
+	}
+	result, _ = r.syncFailed(context.Background(), instance, forbidden)
+	if result.RequeueAfter != 0 || !hasTerminalError(instance) {
+		t.Errorf("Expected a 403 after checking the token again to be terminal, got %+v", result)
+	}
+
+	retries.reset(key)
+	result, _ = r.syncFailed(context.Background(), instance, forbidden)
+	if result.RequeueAfter == 0 {
+		t.Errorf("Expected a 403 to be retried again after the object changed, got %+v", result)
+	}
+}
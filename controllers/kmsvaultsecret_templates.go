@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/valuetemplate"
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// renderTemplates renders the spec.templates of secret with templateData, the decrypted values of its secrets by key,
+// and adds them to data, which has the keys of the secrets (and of their bundles) that are written. Every template
+// that fails is reported in its own event, and then the sync fails, since writing the secret without some of its
+// values could break its consumers. The error is retryable if the only failures are templates that refer to keys that
+// don't exist, since they can come from a partial secret that hasn't been created yet, and terminal otherwise.
+func renderTemplates(ctx context.Context, secret *k8sv1alpha1.KMSVaultSecret, templateData map[string]interface{}, data map[string]interface{}) error {
+	logger := logf.FromContext(ctx)
+	secretKeys := map[string]bool{}
+	for _, s := range secret.Spec.Secrets {
+		if s.Bundle == nil {
+			secretKeys[s.Key] = !s.TemplateOnly
+		}
+	}
+	failed := []string{}
+	onlyMissingKeys := true
+	for _, t := range secret.Spec.Templates {
+		if _, written := data[t.Key]; written || secretKeys[t.Key] {
+			failed = append(failed, t.Key)
+			onlyMissingKeys = false
+			logger.Info("Template has the same key as a secret", "templateKey", t.Key)
+			rec.Event(secret, corev1.EventTypeWarning, "TemplateError", fmt.Sprintf("Template %s has the same key as a secret", t.Key))
+			continue
+		}
+		rendered, err := valuetemplate.Render(t.Key, t.Template, templateData)
+		if err != nil {
+			failed = append(failed, t.Key)
+			onlyMissingKeys = onlyMissingKeys && valuetemplate.IsMissingKey(err)
+			logger.Info("Error rendering template", "templateKey", t.Key, "reason", err.Error())
+			rec.Event(secret, corev1.EventTypeWarning, "TemplateError", fmt.Sprintf("Error rendering template %s: %v", t.Key, err))
+			continue
+		}
+		data[t.Key] = rendered
+	}
+	if len(failed) > 0 && onlyMissingKeys {
+		return retryableErr(fmt.Errorf("Error rendering templates %s", strings.Join(failed, ", ")))
+	}
+	if len(failed) > 0 {
+		return terminalErr(fmt.Errorf("Error rendering templates %s", strings.Join(failed, ", ")))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// tokenLookupServer is a fake Vault server that counts the lookups of a token that expires in an hour.
+func tokenLookupServer(t *testing.T, lookups *int32) *vaultapi.Client {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/lookup-self" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(lookups, 1)
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(w, `{"data": {"expire_time": %q, "ttl": 3600}}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+	}))
+	t.Cleanup(vault.Close)
+	config := vaultapi.DefaultConfig()
+	config.Address = vault.URL
+	c, err := vaultapi.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetToken("token")
+	return c
+}
+
+func TestRenewTokenSharesLookups(t *testing.T) {
+	var lookups int32
+	vaultClient = tokenLookupServer(t, &lookups)
+	forgetToken()
+	defer forgetToken()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := renewToken(context.Background(), VaultTokenAuth{})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if lookups != 1 {
+		t.Errorf("Expected concurrent reconciles to share a single lookup, got %d", lookups)
+	}
+	err := renewToken(context.Background(), VaultTokenAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 1 {
+		t.Errorf("Expected a token that was just looked up to be trusted, got %d lookups", lookups)
+	}
+	forgetToken()
+	err = renewToken(context.Background(), VaultTokenAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 2 {
+		t.Errorf("Expected a forgotten token to be looked up again, got %d lookups", lookups)
+	}
+}
+
+func TestRenewTokenChecksExpiringTokens(t *testing.T) {
+	defer forgetToken()
+	trustToken(&vaultapi.Secret{Data: map[string]interface{}{"ttl": 1}})
+	tokenLock.Lock()
+	until := tokenTrustedUntil
+	tokenLock.Unlock()
+	if time.Until(until) > time.Second {
+		t.Errorf("Expected a token that expires in a second to be trusted for at most a second, got %s", time.Until(until))
+	}
+}
+
+func TestSetVaultClientKeepsToken(t *testing.T) {
+	var lookups int32
+	vaultClient = tokenLookupServer(t, &lookups)
+	defer forgetToken()
+	err := renewToken(context.Background(), VaultTokenAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setVaultClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := getVaultClient().Token(); token != "token" {
+		t.Errorf("Expected the new client to keep the token, got %q", token)
+	}
+	tokenLock.Lock()
+	trusted := time.Now().Before(tokenTrustedUntil)
+	tokenLock.Unlock()
+	if trusted {
+		t.Error("Expected the token to be looked up again with the new client")
+	}
+}
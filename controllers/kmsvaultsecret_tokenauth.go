@@ -3,11 +3,13 @@ package controllers
 import (
 	"errors"
 	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
 )
 
 type VaultTokenAuth struct{}
 
-func (auth VaultTokenAuth) login() error {
+func (auth VaultTokenAuth) login(vaultClient *vaultapi.Client) error {
 	vaultToken, set := os.LookupEnv("VAULT_TOKEN")
 	if !set {
 		return errors.New("VAULT_TOKEN environment variable not found")
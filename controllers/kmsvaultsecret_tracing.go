@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
+)
+
+// vaultRequest runs request against the secret at path in a span called name, with a client that propagates the
+// trace context, and records its metrics under operation.
+func vaultRequest(ctx context.Context, name string, operation string, engine string, path string, vaultClient *vaultapi.Client, request func(*vaultapi.Logical) error) error {
+	ctx, span := tracing.Start(ctx, name, tracing.VaultPathKey.String(path), tracing.VaultEngineKey.String(engine))
+	start := time.Now()
+	err := request(tracing.VaultClient(ctx, vaultClient).Logical())
+	observeVaultRequest(operation, engine, start, err)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	vaultapi "github.com/hashicorp/vault/api"
+	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	testPlaintext  = "hunter2-plaintext"
+	testCiphertext = "AQICAHh-ciphertext"
+	testKMSKey     = "arn:aws:kms:us-east-1:123456789012:key/11111111-2222-3333-4444-555555555555"
+)
+
+// fakeKMS decrypts the ciphertexts in plaintexts, and fails to decrypt any other one.
+type fakeKMS struct {
+	kmsiface.KMSAPI
+	plaintexts map[string]string
+}
+
+func (f fakeKMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	plaintext, ok := f.plaintexts[string(input.CiphertextBlob)]
+	if !ok {
+		return nil, awserr.New(kms.ErrCodeInvalidCiphertextException, "", nil)
+	}
+	return &kms.DecryptOutput{Plaintext: []byte(plaintext), KeyId: aws.String(testKMSKey)}, nil
+}
+
+func TestWriteTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var err error
+	kmsClients, err = kmsutil.NewClientCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kmsClients.SetClient(kmsutil.ClientConfig{}, fakeKMS{plaintexts: map[string]string{testCiphertext: testPlaintext}})
+	rec = record.NewFakeRecorder(10)
+
+	traceparents := []string{}
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer vault.Close()
+	vaultClient, err := vaultapi.NewClient(&vaultapi.Config{Address: vault.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultClient.SetToken("test")
+
+	secret := &k8sv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test"},
+		Spec: k8sv1alpha1.KMSVaultSecretSpec{
+			Secrets: []k8sv1alpha1.Secret{{Key: "password", EncryptedSecret: base64.StdEncoding.EncodeToString([]byte(testCiphertext))}},
+		},
+	}
+	ctx, span := tracing.Start(context.Background(), "Reconcile")
+	err = KVv1Writer{}.write(ctx, secret, "secret/test", decryptOptions{}, vaultClient)
+	span.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for _, s := range exporter.GetSpans() {
+		names[s.Name] = true
+		if s.SpanContext.TraceID() != span.SpanContext().TraceID() {
+			t.Errorf("Span %s is not part of the trace of its parent", s.Name)
+		}
+		values := []string{s.StatusMessage}
+		for _, a := range s.Attributes {
+			values = append(values, a.Value.Emit())
+		}
+		for _, e := range s.MessageEvents {
+			for _, a := range e.Attributes {
+				values = append(values, a.Value.Emit())
+			}
+		}
+		for _, v := range values {
+			if strings.Contains(v, testPlaintext) || strings.Contains(v, testCiphertext) || strings.Contains(v, secret.Spec.Secrets[0].EncryptedSecret) {
+				t.Errorf("Span %s carries a secret value: %s", s.Name, v)
+			}
+		}
+	}
+	for _, name := range []string{"KMS.Decrypt", "Vault.Write"} {
+		if !names[name] {
+			t.Errorf("Expected a %s span, got %v", name, names)
+		}
+	}
+	if len(traceparents) != 1 || !strings.Contains(traceparents[0], span.SpanContext().TraceID().String()) {
+		t.Errorf("Expected the Vault write to carry the trace context, got traceparent headers %v", traceparents)
+	}
+}
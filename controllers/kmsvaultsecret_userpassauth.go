@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
 )
 
 const (
@@ -12,7 +14,7 @@ const (
 
 type VaultUserpassAuth struct{}
 
-func (auth VaultUserpassAuth) login() error {
+func (auth VaultUserpassAuth) login(vaultClient *vaultapi.Client) error {
 	vaultUsername, usernameSet := os.LookupEnv("VAULT_USERNAME")
 	if !usernameSet {
 		return errors.New("Environment variable VAULT_USERNAME not set")
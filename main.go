@@ -17,7 +17,9 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -25,10 +27,12 @@ import (
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	k8sv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
 	"github.com/patoarvizu/kms-vault-operator/controllers"
+	"github.com/patoarvizu/kms-vault-operator/pkg/logging"
+	"github.com/patoarvizu/kms-vault-operator/pkg/redact"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -47,15 +51,56 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var logFormat string
+	var logLevel string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&controllers.VaultAuthenticationMethod, "vault-authentication-method", "token", "Method to be used for the controller to authenticate with Vault")
 	flag.IntVar(&controllers.SyncPeriodSeconds, "sync-period-seconds", 120, "Amount of time in seconds to wait between before syncing the secret to Vault")
+	flag.IntVar(&controllers.MinSyncIntervalSeconds, "min-sync-interval-seconds", 30, "Minimum amount of time in seconds that spec.syncInterval can be set to, shorter intervals are raised to it")
+	flag.IntVar(&controllers.MaxSyncIntervalSeconds, "max-sync-interval-seconds", 0, "Maximum amount of time in seconds between syncs of any secret, including those with spec.syncInterval set to never, 0 means no limit")
+	flag.IntVar(&controllers.SyncJitterPercent, "sync-jitter-percent", 10, "Maximum random amount of time added to the sync interval of each secret, as a percentage of the interval")
+	flag.IntVar(&controllers.RetryBaseDelaySeconds, "retry-base-delay-seconds", 5, "Initial amount of time in seconds to wait before retrying a sync that failed with a retryable error")
+	flag.IntVar(&controllers.RetryMaxDelaySeconds, "retry-max-delay-seconds", 300, "Maximum amount of time in seconds to wait before retrying a sync that failed with a retryable error")
+	flag.IntVar(&controllers.MaxConcurrentReconciles, "max-concurrent-reconciles", 1, "Maximum number of KMSVaultSecrets that can be reconciled concurrently")
+	flag.Float64Var(&controllers.KMSQPS, "kms-qps", 0, "Maximum number of KMS Decrypt calls per second shared across all reconciles, 0 means no limit")
+	flag.IntVar(&controllers.KMSBurst, "kms-burst", 10, "Maximum burst of KMS Decrypt calls allowed on top of --kms-qps")
+	flag.IntVar(&controllers.PlaintextCacheTTLSeconds, "plaintext-cache-ttl-seconds", 0, "Amount of time in seconds to keep decrypted values cached in memory, 0 disables the cache")
+	flag.IntVar(&controllers.PlaintextCacheMaxEntries, "plaintext-cache-max-entries", 1000, "Maximum number of decrypted values to keep cached in memory")
+	flag.StringVar(&controllers.AllowedKMSKeys, "allowed-kms-keys", "", "Comma-separated list of KMS key ids, ARNs or aliases that secrets are allowed to be encrypted with, empty means any key")
+	flag.StringVar(&controllers.PathPrefixTemplate, "path-prefix-template", "", "Template of the Vault path that every secret path must be under, e.g. 'secret/data/{{ .Namespace }}', empty means any path")
+	flag.StringVar(&controllers.RequiredContextKeys, "required-context-keys", "", "Comma-separated list of keys that must be in the encryption context of every secret, as key or key=value, where the value can be a template like {{ .Namespace }}")
+	flag.BoolVar(&controllers.InjectNamespaceContext, "inject-namespace-context", false, "Add kubernetes_namespace=<namespace> to the encryption context of every secret")
+	flag.BoolVar(&controllers.InjectNameContext, "inject-name-context", false, "Also add kubernetes_name=<name> to the encryption context of every secret, requires --inject-namespace-context")
+	flag.BoolVar(&redact.RevealCiphertexts, "log-ciphertexts", false, "Log the ciphertexts that can't be decoded or decrypted instead of their fingerprint, plaintexts are never logged")
+	flag.StringVar(&controllers.OTelEndpoint, "otel-endpoint", "", "Address (host:port) of an OTLP gRPC collector to export traces to, empty disables tracing")
+	flag.BoolVar(&controllers.OTelInsecure, "otel-insecure", false, "Connect to --otel-endpoint without TLS")
+	flag.StringVar(&logFormat, "log-format", logging.ConsoleFormat, "Format of the logs, either 'json' or 'console'")
+	flag.StringVar(&logLevel, "log-level", "info", "Minimum level of the logs, either 'debug', 'info', 'error' or an integer for the verbosity of debug logs")
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	logger, err := logging.New(os.Stderr, logFormat, logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	ctrl.SetLogger(logger)
+	if controllers.KMSQPS > 0 && controllers.KMSBurst < 1 {
+		setupLog.Error(fmt.Errorf("--kms-burst must be at least 1 when --kms-qps is set, got %d", controllers.KMSBurst), "invalid flags")
+		os.Exit(1)
+	}
+	if controllers.PlaintextCacheTTLSeconds > 0 && controllers.PlaintextCacheMaxEntries < 1 {
+		setupLog.Error(fmt.Errorf("--plaintext-cache-max-entries must be at least 1 when --plaintext-cache-ttl-seconds is set, got %d", controllers.PlaintextCacheMaxEntries), "invalid flags")
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), controllers.OTelEndpoint, controllers.OTelInsecure, "kms-vault-operator")
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
@@ -80,7 +125,12 @@ func main() {
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+	shutdownErr := shutdownTracing(context.Background())
+	if shutdownErr != nil {
+		setupLog.Error(shutdownErr, "problem flushing traces")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
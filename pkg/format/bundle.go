@@ -0,0 +1,124 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dotenv is the format of bundles of KEY=value lines.
+const Dotenv string = "dotenv"
+
+// DotenvEntry is a key and its value, in the order they're found in a dotenv file.
+type DotenvEntry struct {
+	Key   string
+	Value string
+}
+
+// ParseDotenv parses KEY=value lines, optionally prefixed by 'export'. Values can be single-quoted (taken literally),
+// double-quoted (with \n, \" and \\ escapes), or unquoted, in which case a trailing ' #' comment is removed. Errors
+// only include line numbers, never the content.
+func ParseDotenv(content []byte) ([]DotenvEntry, error) {
+	entries := []DotenvEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimSpace(strings.TrimPrefix(text, "export "))
+		kv := strings.SplitN(text, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || len(key) == 0 {
+			return nil, fmt.Errorf("Invalid line %d, it must be KEY=value", line)
+		}
+		value := strings.TrimSpace(kv[1])
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		entries = append(entries, DotenvEntry{Key: key, Value: value})
+	}
+	return entries, scanner.Err()
+}
+
+// ExpandBundle parses plaintext, a document in bundleFormat (Dotenv, JSON or YAML), into the values it holds by key.
+// JSON and YAML documents must be objects, and their values are written as they are, like with the JSON format. Only
+// the keys that match one of the include glob patterns (or all, if there are none) and none of the exclude ones are
+// returned, with prefix added to them.
+func ExpandBundle(bundleFormat string, plaintext []byte, prefix string, include []string, exclude []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	switch bundleFormat {
+	case Dotenv:
+		if !utf8.Valid(plaintext) {
+			return nil, errors.New("is not valid UTF-8")
+		}
+		entries, err := ParseDotenv(plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("is not a valid dotenv document: %v", err)
+		}
+		for _, e := range entries {
+			values[e.Key] = e.Value
+		}
+	case JSON, YAML:
+		parsed, err := Parse(bundleFormat, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		object, ok := parsed.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("is not a %s object", bundleFormat)
+		}
+		values = object
+	default:
+		return nil, fmt.Errorf("has an unknown bundle format %s", bundleFormat)
+	}
+	expanded := map[string]interface{}{}
+	for k, v := range values {
+		included, err := matchesAny(include, k, len(include) == 0)
+		if err != nil {
+			return nil, err
+		}
+		excluded, err := matchesAny(exclude, k, false)
+		if err != nil {
+			return nil, err
+		}
+		if included && !excluded {
+			expanded[prefix+k] = v
+		}
+	}
+	return expanded, nil
+}
+
+// CheckPatterns returns an error if any of patterns is not a valid glob pattern.
+func CheckPatterns(patterns []string) error {
+	_, err := matchesAny(patterns, "", false)
+	return err
+}
+
+func matchesAny(patterns []string, key string, ifEmpty bool) (bool, error) {
+	if len(patterns) == 0 {
+		return ifEmpty, nil
+	}
+	matched := false
+	for _, p := range patterns {
+		m, err := path.Match(p, key)
+		if err != nil {
+			return false, fmt.Errorf("has an invalid pattern %s", p)
+		}
+		matched = matched || m
+	}
+	return matched, nil
+}
@@ -0,0 +1,112 @@
+package format
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"unicode/utf8"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	String string = "string"
+	JSON   string = "json"
+	YAML   string = "yaml"
+	Base64 string = "base64"
+	Raw    string = "raw"
+)
+
+var errBase64Structured = errors.New("has outputEncoding base64, which can only be used with the string and base64 formats")
+
+var yamlLine = regexp.MustCompile(`line \d+`)
+
+// Parse converts plaintext to the value that is written to Vault for a secret with format, which is a string for
+// String (or an empty format) and Base64, and whatever plaintext holds for JSON and YAML (an object, a list, a
+// number, etc.). The errors never include the plaintext, or any part of it, so they can be logged and reported.
+func Parse(format string, plaintext []byte) (interface{}, error) {
+	switch format {
+	case "", String:
+		return string(plaintext), nil
+	case JSON:
+		if !utf8.Valid(plaintext) {
+			return nil, errors.New("is not valid UTF-8")
+		}
+		return parseJSON(plaintext)
+	case YAML:
+		if !utf8.Valid(plaintext) {
+			return nil, errors.New("is not valid UTF-8")
+		}
+		j, err := yaml.YAMLToJSON(plaintext)
+		if err != nil {
+			if line := yamlLine.FindString(err.Error()); len(line) > 0 {
+				return nil, fmt.Errorf("is not valid YAML (error at %s)", line)
+			}
+			return nil, errors.New("is not valid YAML")
+		}
+		return parseJSON(j)
+	case Base64:
+		decoded, err := base64.StdEncoding.DecodeString(string(plaintext))
+		if err != nil {
+			return nil, errors.New("is not valid base64")
+		}
+		return string(decoded), nil
+	default:
+		return nil, fmt.Errorf("has an unknown format %s", format)
+	}
+}
+
+// Encode converts a value returned by Parse to how it's written with encoding. A Raw (or empty) encoding writes the
+// value as is, but strings have to be valid UTF-8, since Vault's API is JSON. Base64 writes strings base64-encoded,
+// which is how binary values, like keystores, are written.
+func Encode(encoding string, value interface{}) (interface{}, error) {
+	s, isString := value.(string)
+	switch encoding {
+	case "", Raw:
+		if isString && !utf8.ValidString(s) {
+			return nil, errors.New("is not valid UTF-8, set its outputEncoding to base64 to write binary values")
+		}
+		return value, nil
+	case Base64:
+		if !isString {
+			return nil, errBase64Structured
+		}
+		return base64.StdEncoding.EncodeToString([]byte(s)), nil
+	default:
+		return nil, fmt.Errorf("has an unknown outputEncoding %s", encoding)
+	}
+}
+
+// Check returns an error if format and encoding can't be used together, which can be checked without the plaintext.
+func Check(format string, encoding string) error {
+	if encoding == Base64 && format != "" && format != String && format != Base64 {
+		return errBase64Structured
+	}
+	return nil
+}
+
+// parseJSON decodes a single JSON value, keeping numbers as json.Number so that large integers are written as they
+// are instead of being converted to floats.
+func parseJSON(plaintext []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(plaintext))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err == nil {
+		if _, trailingErr := decoder.Token(); trailingErr != io.EOF {
+			return nil, errors.New("is not valid JSON (it has data after the first value)")
+		}
+	}
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("is not valid JSON (syntax error at offset %d)", syntaxErr.Offset)
+		}
+		return nil, errors.New("is not valid JSON")
+	}
+	return value, nil
+}
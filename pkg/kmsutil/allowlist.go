@@ -0,0 +1,117 @@
+package kmsutil
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+const aliasResolutionTTL = time.Minute * 5
+
+type resolvedAlias struct {
+	keyARN  string
+	expires time.Time
+}
+
+type aliasCacheKey struct {
+	client kmsiface.KMSAPI
+	alias  string
+}
+
+var aliasCacheLock sync.Mutex
+var aliasCache = map[aliasCacheKey]resolvedAlias{}
+
+// KeyAllowlist is a list of KMS keys, identified by key id, key ARN, alias name (e.g. alias/my-key) or alias ARN.
+// An empty list allows every key.
+type KeyAllowlist []string
+
+// ParseKeyAllowlist splits a comma-separated list of keys, like the value of an --allowed-kms-keys flag.
+func ParseKeyAllowlist(keys string) KeyAllowlist {
+	allowlist := KeyAllowlist{}
+	for _, k := range strings.Split(keys, ",") {
+		k = strings.TrimSpace(k)
+		if len(k) > 0 {
+			allowlist = append(allowlist, k)
+		}
+	}
+	return allowlist
+}
+
+// Allows reports whether the key with ARN keyARN (as returned on a DecryptOutput) is in the allowlist. Aliases are
+// resolved with client, so it needs to be a client for the region where the key lives.
+func (a KeyAllowlist) Allows(client kmsiface.KMSAPI, keyARN string) (bool, error) {
+	if len(a) == 0 {
+		return true, nil
+	}
+	for _, allowed := range a {
+		if allowed == keyARN || strings.HasSuffix(keyARN, ":key/"+allowed) {
+			return true, nil
+		}
+		if !isAlias(allowed) {
+			continue
+		}
+		resolved, err := resolveAlias(client, allowed)
+		if err != nil {
+			return false, err
+		}
+		if resolved == keyARN {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func isAlias(key string) bool {
+	return strings.HasPrefix(key, "alias/") || (strings.HasPrefix(key, "arn:") && strings.Contains(key, ":alias/"))
+}
+
+func resolveAlias(client kmsiface.KMSAPI, alias string) (string, error) {
+	key := aliasCacheKey{client: client, alias: alias}
+	aliasCacheLock.Lock()
+	cached, ok := aliasCache[key]
+	aliasCacheLock.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.keyARN, nil
+	}
+	output, err := client.DescribeKey(&kms.DescribeKeyInput{KeyId: aws.String(alias)})
+	if err != nil {
+		return "", err
+	}
+	keyARN := aws.StringValue(output.KeyMetadata.Arn)
+	aliasCacheLock.Lock()
+	aliasCache[key] = resolvedAlias{keyARN: keyARN, expires: time.Now().Add(aliasResolutionTTL)}
+	aliasCacheLock.Unlock()
+	return keyARN, nil
+}
+
+// FirstKey returns the first key of the first allowlist that isn't empty, or an empty string if they're all empty.
+func FirstKey(allowlists ...KeyAllowlist) string {
+	for _, a := range allowlists {
+		if len(a) > 0 {
+			return a[0]
+		}
+	}
+	return ""
+}
+
+// DecryptKeyID returns the key id to set on a DecryptInput, so KMS itself rejects ciphertexts encrypted under other
+// keys. That's only possible if there's a single key allowed across all allowlists, otherwise it returns nil.
+func DecryptKeyID(allowlists ...KeyAllowlist) *string {
+	var keyID string
+	for _, a := range allowlists {
+		for _, k := range a {
+			if len(keyID) > 0 && keyID != k {
+				return nil
+			}
+			keyID = k
+		}
+	}
+	if len(keyID) == 0 {
+		return nil
+	}
+	return aws.String(keyID)
+}
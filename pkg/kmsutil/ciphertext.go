@@ -0,0 +1,24 @@
+package kmsutil
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// CiphertextKeyID returns the ARN of the KMS key that ciphertext was encrypted with, without decrypting it. AWS doesn't
+// document the format of ciphertexts, so the key is found with kms:ReEncrypt, which re-encrypts ciphertext under
+// destinationKeyID inside of KMS and reports the source key, but never returns the plaintext. The new ciphertext is
+// discarded. Like kms:Decrypt, it fails if encryptionContext doesn't match the one ciphertext was encrypted with.
+func CiphertextKeyID(svc kmsiface.KMSAPI, ciphertext []byte, encryptionContext map[string]*string, destinationKeyID string) (string, error) {
+	output, err := svc.ReEncrypt(&kms.ReEncryptInput{
+		CiphertextBlob:               ciphertext,
+		SourceEncryptionContext:      encryptionContext,
+		DestinationKeyId:             aws.String(destinationKeyID),
+		DestinationEncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.SourceKeyId), nil
+}
@@ -0,0 +1,50 @@
+package kmsutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// reencryptKMS re-encrypts everything from sourceKeyID, unless the encryption context doesn't match context.
+type reencryptKMS struct {
+	kmsiface.KMSAPI
+	sourceKeyID string
+	context     map[string]string
+	inputs      []*kms.ReEncryptInput
+}
+
+func (k *reencryptKMS) ReEncrypt(input *kms.ReEncryptInput) (*kms.ReEncryptOutput, error) {
+	k.inputs = append(k.inputs, input)
+	if len(aws.StringValueMap(input.SourceEncryptionContext)) != len(k.context) {
+		return nil, errors.New("InvalidCiphertextException")
+	}
+	for key, value := range k.context {
+		if aws.StringValue(input.SourceEncryptionContext[key]) != value {
+			return nil, errors.New("InvalidCiphertextException")
+		}
+	}
+	return &kms.ReEncryptOutput{SourceKeyId: aws.String(k.sourceKeyID), KeyId: input.DestinationKeyId, CiphertextBlob: []byte("discarded")}, nil
+}
+
+func TestCiphertextKeyID(t *testing.T) {
+	keyARN := "arn:aws:kms:us-east-1:123456789012:key/app"
+	svc := &reencryptKMS{sourceKeyID: keyARN, context: map[string]string{"app": "api"}}
+	keyID, err := CiphertextKeyID(svc, []byte("ciphertext"), aws.StringMap(map[string]string{"app": "api"}), "alias/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != keyARN {
+		t.Errorf("Expected the key of the ciphertext to be %s, got %s", keyARN, keyID)
+	}
+	if aws.StringValue(svc.inputs[0].DestinationKeyId) != "alias/app" {
+		t.Errorf("Expected the ciphertext to be re-encrypted under alias/app, got %s", aws.StringValue(svc.inputs[0].DestinationKeyId))
+	}
+	_, err = CiphertextKeyID(svc, []byte("ciphertext"), aws.StringMap(map[string]string{"app": "other"}), "alias/app")
+	if err == nil {
+		t.Error("Expected an error when the encryption context doesn't match")
+	}
+}
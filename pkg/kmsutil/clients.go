@@ -0,0 +1,68 @@
+package kmsutil
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// ClientConfig identifies a KMS client by the region it talks to and the IAM role it assumes (if any). Empty values
+// mean the defaults from the environment, i.e. the region and credentials discovered by the default provider chain.
+type ClientConfig struct {
+	Region     string
+	RoleARN    string
+	ExternalID string
+}
+
+// ClientCache holds one KMS client per ClientConfig, all derived from a single base AWS session, so that sessions and
+// assumed role credentials are reused across calls instead of being created every time.
+type ClientCache struct {
+	lock    sync.Mutex
+	session *session.Session
+	clients map[ClientConfig]kmsiface.KMSAPI
+}
+
+func NewClientCache() (*ClientCache, error) {
+	awsSession, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return &ClientCache{
+		session: awsSession,
+		clients: map[ClientConfig]kmsiface.KMSAPI{},
+	}, nil
+}
+
+// Client returns the cached KMS client for config, creating it if it doesn't exist yet.
+func (c *ClientCache) Client(config ClientConfig) kmsiface.KMSAPI {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if client, ok := c.clients[config]; ok {
+		return client
+	}
+	awsConfig := aws.NewConfig()
+	if len(config.Region) > 0 {
+		awsConfig = awsConfig.WithRegion(config.Region)
+	}
+	if len(config.RoleARN) > 0 {
+		awsConfig = awsConfig.WithCredentials(stscreds.NewCredentials(c.session, config.RoleARN, func(p *stscreds.AssumeRoleProvider) {
+			if len(config.ExternalID) > 0 {
+				p.ExternalID = aws.String(config.ExternalID)
+			}
+		}))
+	}
+	client := kms.New(c.session, awsConfig)
+	c.clients[config] = client
+	return client
+}
+
+// SetClient overrides the client used for config, e.g. with a mock.
+func (c *ClientCache) SetClient(config ClientConfig, client kmsiface.KMSAPI) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.clients[config] = client
+}
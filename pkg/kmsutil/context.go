@@ -0,0 +1,18 @@
+package kmsutil
+
+const (
+	// NamespaceContextKey is the encryption context key that binds a ciphertext to a Kubernetes namespace.
+	NamespaceContextKey = "kubernetes_namespace"
+	// NameContextKey is the encryption context key that binds a ciphertext to the name of a KMSVaultSecret.
+	NameContextKey = "kubernetes_name"
+)
+
+// ObjectContext returns the encryption context entries that bind a ciphertext to namespace, and to name if
+// includeName is true.
+func ObjectContext(namespace string, name string, includeName bool) map[string]string {
+	context := map[string]string{NamespaceContextKey: namespace}
+	if includeName {
+		context[NameContextKey] = name
+	}
+	return context
+}
@@ -0,0 +1,86 @@
+package kmsutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// Envelope is a value encrypted locally with AES-256-GCM under a data key, which is in turn encrypted with KMS. It
+// holds values larger than the 4 KB that KMS Encrypt accepts, with a single kms:Decrypt call to open it. It's
+// encoded as JSON, so its fields are base64-encoded.
+type Envelope struct {
+	// Key is the KMS ciphertext of the data key, which is checked and decrypted like any other ciphertext.
+	Key        []byte `json:"key"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// SealEnvelope encrypts plaintext under a new data key of the KMS key keyID, generated with encryptionContext.
+func SealEnvelope(svc kmsiface.KMSAPI, keyID string, plaintext []byte, encryptionContext map[string]string) ([]byte, error) {
+	input := &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	}
+	if len(encryptionContext) > 0 {
+		input.EncryptionContext = aws.StringMap(encryptionContext)
+	}
+	dataKey, err := svc.GenerateDataKey(input)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		Key:        dataKey.CiphertextBlob,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// ParseEnvelope checks the structure of an encoded envelope, without decrypting it.
+func ParseEnvelope(encoded []byte) (*Envelope, error) {
+	envelope := &Envelope{}
+	err := json.Unmarshal(encoded, envelope)
+	if err != nil || len(envelope.Key) == 0 || len(envelope.Ciphertext) == 0 {
+		return nil, errors.New("Invalid envelope, it must have a key and a ciphertext")
+	}
+	return envelope, nil
+}
+
+// Open decrypts the value of the envelope with dataKey, the plaintext of its Key.
+func (e *Envelope) Open(dataKey []byte) ([]byte, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("Invalid envelope nonce")
+	}
+	plaintext, err := gcm.Open(nil, e.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("Error decrypting envelope, its ciphertext doesn't match its key")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("Invalid envelope data key")
+	}
+	return cipher.NewGCM(block)
+}
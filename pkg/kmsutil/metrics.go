@@ -0,0 +1,102 @@
+package kmsutil
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UnknownKey is the key label of the metrics for ciphertexts whose key is not known, e.g. because they couldn't be
+// decrypted.
+const UnknownKey = "unknown"
+
+// DecryptMetrics counts and times kms:Decrypt calls, and counts the ciphertexts that are rejected before or after
+// being decrypted. A nil *DecryptMetrics records nothing.
+type DecryptMetrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewDecryptMetrics returns the metrics of a binary, named kms_vault_<subsystem>_kms_decrypt_*.
+func NewDecryptMetrics(subsystem string) *DecryptMetrics {
+	return &DecryptMetrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "kms_vault",
+				Subsystem: subsystem,
+				Name:      "kms_decrypt_requests_total",
+				Help:      "Number of kms:Decrypt requests, by KMS key",
+			},
+			[]string{"key"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "kms_vault",
+				Subsystem: subsystem,
+				Name:      "kms_decrypt_errors_total",
+				Help:      "Number of ciphertexts that couldn't be decrypted or were rejected, by KMS key and reason",
+			},
+			[]string{"key", "reason"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "kms_vault",
+				Subsystem: subsystem,
+				Name:      "kms_decrypt_duration_seconds",
+				Help:      "Latency of kms:Decrypt requests, by KMS key",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"key"},
+		),
+	}
+}
+
+// Collectors returns the collectors to register.
+func (m *DecryptMetrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.requests, m.errors, m.duration}
+}
+
+// Decrypt calls kms:Decrypt with input and records it. Requests that fail are recorded with the key id of input, if
+// set, since the key of the ciphertext is only known when it's decrypted.
+func (m *DecryptMetrics) Decrypt(svc kmsiface.KMSAPI, input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	start := time.Now()
+	output, err := svc.Decrypt(input)
+	if m == nil {
+		return output, err
+	}
+	key := UnknownKey
+	if err == nil {
+		key = aws.StringValue(output.KeyId)
+	} else if input.KeyId != nil {
+		key = aws.StringValue(input.KeyId)
+	}
+	m.requests.WithLabelValues(key).Inc()
+	m.duration.WithLabelValues(key).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(key, ErrorReason(err)).Inc()
+	}
+	return output, err
+}
+
+// Rejected records a ciphertext that was not decrypted, or whose plaintext was discarded, for reason.
+func (m *DecryptMetrics) Rejected(key string, reason string) {
+	if m == nil {
+		return
+	}
+	m.errors.WithLabelValues(key, reason).Inc()
+}
+
+// ErrorReason returns the AWS error code of err (e.g. InvalidCiphertextException), or "Error" if it doesn't have one.
+func ErrorReason(err error) string {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Code()
+	}
+	return "Error"
+}
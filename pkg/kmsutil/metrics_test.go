@@ -0,0 +1,76 @@
+package kmsutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// decryptKMS decrypts everything with keyID, or fails with err if set.
+type decryptKMS struct {
+	kmsiface.KMSAPI
+	keyID string
+	err   error
+}
+
+func (k *decryptKMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+	return &kms.DecryptOutput{KeyId: aws.String(k.keyID), Plaintext: []byte("secret")}, nil
+}
+
+func TestDecryptMetrics(t *testing.T) {
+	m := NewDecryptMetrics("test")
+	keyID := "arn:aws:kms:us-east-1:123456789012:key/app"
+	_, err := m.Decrypt(&decryptKMS{keyID: keyID}, &kms.DecryptInput{CiphertextBlob: []byte("c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	denied := awserr.New(kms.ErrCodeInvalidCiphertextException, "denied", nil)
+	m.Decrypt(&decryptKMS{err: denied}, &kms.DecryptInput{CiphertextBlob: []byte("c")})
+	m.Decrypt(&decryptKMS{err: denied}, &kms.DecryptInput{CiphertextBlob: []byte("c"), KeyId: aws.String("alias/app")})
+	m.Rejected(keyID, "KMSKeyNotAllowed")
+
+	for _, tc := range []struct {
+		value    float64
+		expected float64
+		metric   string
+	}{
+		{testutil.ToFloat64(m.requests.WithLabelValues(keyID)), 1, "requests for the key"},
+		{testutil.ToFloat64(m.requests.WithLabelValues(UnknownKey)), 1, "requests for an unknown key"},
+		{testutil.ToFloat64(m.requests.WithLabelValues("alias/app")), 1, "requests for the key of the input"},
+		{testutil.ToFloat64(m.errors.WithLabelValues(UnknownKey, kms.ErrCodeInvalidCiphertextException)), 1, "errors for an unknown key"},
+		{testutil.ToFloat64(m.errors.WithLabelValues(keyID, "KMSKeyNotAllowed")), 1, "rejected ciphertexts"},
+	} {
+		if tc.value != tc.expected {
+			t.Errorf("Expected %v %s, got %v", tc.expected, tc.metric, tc.value)
+		}
+	}
+	if count := testutil.CollectAndCount(m.duration); count != 3 {
+		t.Errorf("Expected latencies for 3 keys, got %d", count)
+	}
+}
+
+func TestNilDecryptMetrics(t *testing.T) {
+	var m *DecryptMetrics
+	output, err := m.Decrypt(&decryptKMS{keyID: "alias/app"}, &kms.DecryptInput{})
+	if err != nil || string(output.Plaintext) != "secret" {
+		t.Errorf("Expected a nil DecryptMetrics to still decrypt, got %v", err)
+	}
+	m.Rejected("alias/app", "Error")
+}
+
+func TestErrorReason(t *testing.T) {
+	if reason := ErrorReason(awserr.New(kms.ErrCodeDisabledException, "denied", nil)); reason != kms.ErrCodeDisabledException {
+		t.Errorf("Expected the AWS error code, got %s", reason)
+	}
+	if reason := ErrorReason(errors.New("timeout")); reason != "Error" {
+		t.Errorf("Expected Error for errors without a code, got %s", reason)
+	}
+}
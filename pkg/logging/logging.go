@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const (
+	JSONFormat    string = "json"
+	ConsoleFormat string = "console"
+)
+
+// Keys of the fields that the operator and the webhook log, so the same thing has the same name in both.
+const (
+	NamespaceKey    = "namespace"
+	NameKey         = "name"
+	KindKey         = "kind"
+	PathKey         = "path"
+	EngineKey       = "engine"
+	AuthMethodKey   = "authMethod"
+	ReconcileIDKey  = "reconcileID"
+	OperationKey    = "operation"
+	AdmissionUIDKey = "admissionUID"
+	AuditIDKey      = "auditID"
+)
+
+// New returns a logger that writes to out in format (JSONFormat or ConsoleFormat), discarding the messages less
+// severe than level. The level is either debug, info or error, or an integer for the verbosity of V() messages, where
+// 1 is the same as debug.
+func New(out io.Writer, format string, level string) (logr.Logger, error) {
+	options := []zap.Opts{zap.WriteTo(out)}
+	timeEncoder := func(c *zapcore.EncoderConfig) {
+		c.EncodeTime = zapcore.ISO8601TimeEncoder
+	}
+	switch format {
+	case JSONFormat:
+		options = append(options, zap.JSONEncoder(timeEncoder))
+	case ConsoleFormat:
+		options = append(options, zap.ConsoleEncoder(timeEncoder))
+	default:
+		return nil, fmt.Errorf("Invalid log format %s, it must be %s or %s", format, JSONFormat, ConsoleFormat)
+	}
+	zapLevel, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	options = append(options, zap.Level(zapLevel))
+	return zap.New(options...), nil
+}
+
+func parseLevel(level string) (zapcore.Level, error) {
+	switch level {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "info":
+		return zapcore.InfoLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+	verbosity, err := strconv.Atoi(level)
+	if err != nil || verbosity < 0 {
+		return 0, fmt.Errorf("Invalid log level %s, it must be debug, info, error or a positive integer", level)
+	}
+	return zapcore.Level(-verbosity), nil
+}
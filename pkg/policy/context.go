@@ -0,0 +1,54 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ContextRequirement is a key that must be in the encryption context of a secret. If ValueTemplate is set, the value
+// of the key must also be equal to it, rendered with the same fields as a path template.
+type ContextRequirement struct {
+	Key           string
+	ValueTemplate string
+}
+
+// ParseContextRequirements parses entries in the form key or key=template, e.g. app or namespace={{ .Namespace }}.
+func ParseContextRequirements(entries []string) []ContextRequirement {
+	requirements := []ContextRequirement{}
+	for _, e := range entries {
+		kv := strings.SplitN(strings.TrimSpace(e), "=", 2)
+		if len(kv[0]) == 0 {
+			continue
+		}
+		requirement := ContextRequirement{Key: kv[0]}
+		if len(kv) == 2 {
+			requirement.ValueTemplate = kv[1]
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements
+}
+
+// CheckContext checks that encryptionContext satisfies every requirement, with value templates rendered for obj. It
+// returns the reason why it doesn't, or an empty string if it does.
+func CheckContext(requirements []ContextRequirement, encryptionContext map[string]*string, obj metav1.Object) (string, error) {
+	for _, r := range requirements {
+		value, ok := encryptionContext[r.Key]
+		if !ok || value == nil {
+			return fmt.Sprintf("is missing required encryption context key %s", r.Key), nil
+		}
+		if len(r.ValueTemplate) == 0 {
+			continue
+		}
+		expected, err := render(r.ValueTemplate, obj)
+		if err != nil {
+			return fmt.Sprintf("has encryption context key %s that can't be checked: %v", r.Key, err), nil
+		}
+		if *value != expected {
+			return fmt.Sprintf("has encryption context key %s with value %s, but it must be %s", r.Key, *value, expected), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,79 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// templateData is what the templates in spec.path, --path-prefix-template and required encryption context values
+// can refer to.
+type templateData struct {
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// RenderPath renders pathTemplate, a Go template that can refer to {{ .Namespace }}, {{ .Name }}, {{ .Labels }} and
+// {{ .Annotations }} of obj. Referring to a label or annotation that is not set is an error, and so is a rendered
+// path with empty, '.' or '..' segments, so a template can't be used to escape the path it's expected to be under.
+func RenderPath(pathTemplate string, obj metav1.Object) (string, error) {
+	rendered, err := render(pathTemplate, obj)
+	if err != nil {
+		return "", err
+	}
+	path := strings.Trim(rendered, "/")
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("Path template %s rendered an invalid path %s", pathTemplate, rendered)
+		}
+	}
+	return path, nil
+}
+
+// SecretPath returns the path that secret writes to. It's the path recorded in its status if spec.path hasn't changed
+// since it was rendered, so changing the labels or annotations that it refers to doesn't move the secret.
+func SecretPath(secret *kmsvaultv1alpha1.KMSVaultSecret) (string, error) {
+	if len(secret.Status.Path) > 0 && secret.Status.PathTemplate == secret.Spec.Path {
+		return secret.Status.Path, nil
+	}
+	return RenderPath(secret.Spec.Path, secret)
+}
+
+// PathPrefix renders pathPrefixTemplate for obj, or returns an empty prefix if no template is set.
+func PathPrefix(pathPrefixTemplate string, obj metav1.Object) (string, error) {
+	if len(pathPrefixTemplate) == 0 {
+		return "", nil
+	}
+	return RenderPath(pathPrefixTemplate, obj)
+}
+
+func render(text string, obj metav1.Object) (string, error) {
+	t, err := template.New("value").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("Invalid template %s: %w", text, err)
+	}
+	var rendered bytes.Buffer
+	err = t.Execute(&rendered, templateData{
+		Namespace:   obj.GetNamespace(),
+		Name:        obj.GetName(),
+		Labels:      obj.GetLabels(),
+		Annotations: obj.GetAnnotations(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error rendering template %s: %w", text, err)
+	}
+	return rendered.String(), nil
+}
+
+// UnderPrefix reports whether path is prefix, or is inside of it.
+func UnderPrefix(prefix string, path string) bool {
+	prefix = strings.Trim(prefix, "/")
+	path = strings.Trim(path, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
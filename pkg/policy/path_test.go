@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"testing"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderPath(t *testing.T) {
+	obj := &metav1.ObjectMeta{Namespace: "team-a", Name: "db", Labels: map[string]string{"app": "api"}}
+	for template, expected := range map[string]string{
+		"/secret/data/{{ .Namespace }}/{{ .Labels.app }}/{{ .Name }}/": "secret/data/team-a/api/db",
+		"secret/data/static": "secret/data/static",
+	} {
+		path, err := RenderPath(template, obj)
+		if err != nil || path != expected {
+			t.Errorf("Expected %s to render %s, got %s, %v", template, expected, path, err)
+		}
+	}
+	for _, template := range []string{
+		"secret/data/{{ .Labels.missing }}",
+		"secret/data/{{ .Labels.app }}/../team-b",
+		"secret//data",
+		"secret/data/{{",
+	} {
+		if path, err := RenderPath(template, obj); err == nil {
+			t.Errorf("Expected %s to be invalid, got %s", template, path)
+		}
+	}
+}
+
+func TestSecretPath(t *testing.T) {
+	secret := &kmsvaultv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db", Labels: map[string]string{"app": "web"}},
+		Spec:       kmsvaultv1alpha1.KMSVaultSecretSpec{Path: "secret/data/{{ .Labels.app }}"},
+	}
+	for name, tc := range map[string]struct {
+		status   kmsvaultv1alpha1.KMSVaultSecretStatus
+		expected string
+	}{
+		"never written":      {kmsvaultv1alpha1.KMSVaultSecretStatus{}, "secret/data/web"},
+		"written":            {kmsvaultv1alpha1.KMSVaultSecretStatus{Path: "secret/data/api", PathTemplate: "secret/data/{{ .Labels.app }}"}, "secret/data/api"},
+		"spec.path changed":  {kmsvaultv1alpha1.KMSVaultSecretStatus{Path: "secret/data/api", PathTemplate: "secret/data/{{ .Name }}"}, "secret/data/web"},
+		"template not saved": {kmsvaultv1alpha1.KMSVaultSecretStatus{Path: "secret/data/api"}, "secret/data/web"},
+	} {
+		secret.Status = tc.status
+		path, err := SecretPath(secret)
+		if err != nil || path != tc.expected {
+			t.Errorf("%s: expected %s, got %s, %v", name, tc.expected, path, err)
+		}
+	}
+}
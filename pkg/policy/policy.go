@@ -0,0 +1,196 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Target is what a KMSVaultSecret will write to Vault, as seen by the KMSVaultPolicies.
+type Target struct {
+	Namespace string
+	// Path is the rendered Vault path.
+	Path string
+	// PathPrefix is the rendered --path-prefix-template, if set, that Path must be under.
+	PathPrefix    string
+	EngineVersion string
+	// RoleARN is the IAM role assumed to decrypt the secrets, if any.
+	RoleARN string
+}
+
+// SecretTarget renders the path of secret, and pathPrefixTemplate if set. A secret without a KV engine version
+// writes to a v1 engine.
+func SecretTarget(secret *kmsvaultv1alpha1.KMSVaultSecret, pathPrefixTemplate string) (Target, error) {
+	path, err := SecretPath(secret)
+	if err != nil {
+		return Target{}, err
+	}
+	prefix, err := PathPrefix(pathPrefixTemplate, secret)
+	if err != nil {
+		return Target{}, err
+	}
+	engineVersion := secret.Spec.KVSettings.EngineVersion
+	if len(engineVersion) == 0 {
+		engineVersion = "v1"
+	}
+	return Target{
+		Namespace:     secret.Namespace,
+		Path:          path,
+		PathPrefix:    prefix,
+		EngineVersion: engineVersion,
+		RoleARN:       secret.Spec.KMS.RoleARN,
+	}, nil
+}
+
+// Decision is the result of evaluating the KMSVaultPolicies that apply to a Target.
+type Decision struct {
+	Allowed bool
+	// Message explains why the target is not allowed.
+	Message string
+	// AllowedKMSKeys is the list of KMS keys that the secrets of the target can be encrypted with, empty if the
+	// policies don't restrict them.
+	AllowedKMSKeys kmsutil.KeyAllowlist
+}
+
+// Evaluate checks that the path of target is under its path prefix, then looks up the KMSVaultPolicies whose namespace
+// selector matches the namespace of target, and checks that at least one of them allows its path, engine version and
+// role. If no policy selects the namespace, the target is allowed, unless it assumes a role, since the roles that the
+// operator can assume may give access to keys in other accounts.
+func Evaluate(ctx context.Context, c client.Client, target Target) (Decision, error) {
+	if len(target.PathPrefix) > 0 && !UnderPrefix(target.PathPrefix, target.Path) {
+		return Decision{
+			Allowed: false,
+			Message: fmt.Sprintf("Path %s is not under %s", target.Path, target.PathPrefix),
+		}, nil
+	}
+	policies := &kmsvaultv1alpha1.KMSVaultPolicyList{}
+	err := c.List(ctx, policies)
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(policies.Items) == 0 {
+		return evaluate(nil, labels.Set{}, target)
+	}
+	namespace := &corev1.Namespace{}
+	err = c.Get(ctx, client.ObjectKey{Name: target.Namespace}, namespace)
+	if err != nil {
+		return Decision{}, err
+	}
+	return evaluate(policies.Items, labels.Set(namespace.Labels), target)
+}
+
+func evaluate(policies []kmsvaultv1alpha1.KMSVaultPolicy, namespaceLabels labels.Set, target Target) (Decision, error) {
+	matching := []string{}
+	allowedKeys := kmsutil.KeyAllowlist{}
+	allowed := false
+	anyKey := false
+	for _, p := range policies {
+		selector, err := metav1.LabelSelectorAsSelector(&p.Spec.NamespaceSelector)
+		if err != nil {
+			return Decision{}, fmt.Errorf("Invalid namespace selector in KMSVaultPolicy %s: %w", p.Name, err)
+		}
+		if !selector.Matches(namespaceLabels) {
+			continue
+		}
+		matching = append(matching, p.Name)
+		if !pathAllowed(p.Spec.AllowedPaths, target.Path) || !engineAllowed(p.Spec.AllowedEngineVersions, target.EngineVersion) || !roleAllowed(p.Spec.AllowedKMSRoleARNs, target.RoleARN) {
+			continue
+		}
+		allowed = true
+		if len(p.Spec.AllowedKMSKeys) == 0 {
+			anyKey = true
+		}
+		allowedKeys = append(allowedKeys, p.Spec.AllowedKMSKeys...)
+	}
+	if len(matching) == 0 && len(target.RoleARN) > 0 {
+		return Decision{
+			Allowed: false,
+			Message: fmt.Sprintf("Assuming role %s is not allowed in namespace %s, since no KMSVaultPolicy applies to it", target.RoleARN, target.Namespace),
+		}, nil
+	}
+	if len(matching) == 0 {
+		return Decision{Allowed: true}, nil
+	}
+	if anyKey {
+		allowedKeys = kmsutil.KeyAllowlist{}
+	}
+	if !allowed {
+		role := ""
+		if len(target.RoleARN) > 0 {
+			role = fmt.Sprintf(" and role %s", target.RoleARN)
+		}
+		return Decision{
+			Allowed: false,
+			Message: fmt.Sprintf("Writing to path %s with KV engine %s%s is not allowed in namespace %s by KMSVaultPolicies %s", target.Path, target.EngineVersion, role, target.Namespace, strings.Join(matching, ", ")),
+		}, nil
+	}
+	return Decision{Allowed: true, AllowedKMSKeys: allowedKeys}, nil
+}
+
+func engineAllowed(allowedEngineVersions []kmsvaultv1alpha1.KVEngineVersion, engineVersion string) bool {
+	if len(allowedEngineVersions) == 0 {
+		return true
+	}
+	for _, v := range allowedEngineVersions {
+		if string(v) == engineVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// roleAllowed reports whether role is in allowedRoles, where no role is always allowed, but an empty list doesn't
+// allow any role.
+func roleAllowed(allowedRoles []string, role string) bool {
+	if len(role) == 0 {
+		return true
+	}
+	for _, glob := range allowedRoles {
+		if MatchPath(glob, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathAllowed(allowedPaths []string, path string) bool {
+	if len(allowedPaths) == 0 {
+		return true
+	}
+	path = strings.Trim(path, "/")
+	for _, glob := range allowedPaths {
+		if MatchPath(glob, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether path matches glob, where '*' matches any characters within a path segment and '**'
+// matches any characters, including '/'. Leading and trailing slashes are ignored.
+func MatchPath(glob string, path string) bool {
+	var expression strings.Builder
+	expression.WriteString("^")
+	glob = strings.Trim(glob, "/")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expression.WriteString("[^/]*")
+		default:
+			expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.MustCompile(expression.String()).MatchString(strings.Trim(path, "/"))
+}
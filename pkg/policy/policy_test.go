@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func fakeClient(t *testing.T, objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kmsvaultv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func teamPolicy(name string, team string, spec kmsvaultv1alpha1.KMSVaultPolicySpec) *kmsvaultv1alpha1.KMSVaultPolicy {
+	spec.NamespaceSelector = metav1.LabelSelector{MatchLabels: map[string]string{"team": team}}
+	return &kmsvaultv1alpha1.KMSVaultPolicy{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+}
+
+func TestEvaluate(t *testing.T) {
+	namespaces := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+	}
+	policies := []client.Object{
+		teamPolicy("team-a", "a", kmsvaultv1alpha1.KMSVaultPolicySpec{
+			AllowedPaths:          []string{"secret/team-a/**"},
+			AllowedEngineVersions: []kmsvaultv1alpha1.KVEngineVersion{"v2"},
+			AllowedKMSKeys:        []string{"alias/team-a"},
+			AllowedKMSRoleARNs:    []string{"arn:aws:iam::123456789012:role/team-a-*"},
+		}),
+		teamPolicy("team-a-shared", "a", kmsvaultv1alpha1.KMSVaultPolicySpec{
+			AllowedPaths:   []string{"secret/shared/*/team-a"},
+			AllowedKMSKeys: []string{"alias/shared"},
+		}),
+	}
+	withPolicies := fakeClient(t, append(namespaces, policies...)...)
+	withoutPolicies := fakeClient(t, namespaces...)
+	for name, tc := range map[string]struct {
+		client  client.Client
+		target  Target
+		allowed bool
+		keys    []string
+	}{
+		"no policies":                   {withoutPolicies, Target{Namespace: "team-a", Path: "secret/any", EngineVersion: "v1"}, true, nil},
+		"no policies with a role":       {withoutPolicies, Target{Namespace: "team-a", Path: "secret/any", EngineVersion: "v1", RoleARN: "arn:aws:iam::123456789012:role/admin"}, false, nil},
+		"unselected namespace":          {withPolicies, Target{Namespace: "other", Path: "secret/team-a/app", EngineVersion: "v1"}, true, nil},
+		"unselected namespace and role": {withPolicies, Target{Namespace: "other", Path: "secret/any", EngineVersion: "v1", RoleARN: "arn:aws:iam::123456789012:role/team-a-kms"}, false, nil},
+		"allowed path":                  {withPolicies, Target{Namespace: "team-a", Path: "secret/team-a/app/db", EngineVersion: "v2"}, true, []string{"alias/team-a"}},
+		"allowed path and role":         {withPolicies, Target{Namespace: "team-a", Path: "/secret/team-a/app/", EngineVersion: "v2", RoleARN: "arn:aws:iam::123456789012:role/team-a-kms"}, true, []string{"alias/team-a"}},
+		"path allowed by another":       {withPolicies, Target{Namespace: "team-a", Path: "secret/shared/db/team-a", EngineVersion: "v1"}, true, []string{"alias/shared"}},
+		"path not allowed":              {withPolicies, Target{Namespace: "team-a", Path: "secret/team-b/app", EngineVersion: "v2"}, false, nil},
+		"engine not allowed":            {withPolicies, Target{Namespace: "team-a", Path: "secret/team-a/app", EngineVersion: "v1"}, false, nil},
+		"role not allowed":              {withPolicies, Target{Namespace: "team-a", Path: "secret/team-a/app", EngineVersion: "v2", RoleARN: "arn:aws:iam::123456789012:role/team-b-kms"}, false, nil},
+		"role not allowed by the path":  {withPolicies, Target{Namespace: "team-a", Path: "secret/shared/db/team-a", EngineVersion: "v1", RoleARN: "arn:aws:iam::123456789012:role/team-a-kms"}, false, nil},
+		"outside of the prefix":         {withoutPolicies, Target{Namespace: "team-a", Path: "secret/team-b/app", PathPrefix: "secret/team-a", EngineVersion: "v1"}, false, nil},
+	} {
+		decision, err := Evaluate(context.Background(), tc.client, tc.target)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if decision.Allowed != tc.allowed {
+			t.Errorf("%s: expected allowed to be %v, got %v (%s)", name, tc.allowed, decision.Allowed, decision.Message)
+		}
+		if !decision.Allowed && len(decision.Message) == 0 {
+			t.Errorf("%s: expected a message explaining why it's not allowed", name)
+		}
+		if len(decision.AllowedKMSKeys) != len(tc.keys) {
+			t.Errorf("%s: expected allowed keys %v, got %v", name, tc.keys, decision.AllowedKMSKeys)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	for _, tc := range []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"secret/team-a/*", "secret/team-a/app", true},
+		{"secret/team-a/*", "secret/team-a/app/db", false},
+		{"secret/team-a/**", "secret/team-a/app/db", true},
+		{"/secret/team-a/*/", "secret/team-a/app", true},
+		{"secret/*/team-a", "secret/shared/team-a", true},
+		{"secret/team.a/*", "secret/teamXa/app", false},
+		{"arn:aws:iam::123456789012:role/team-a-*", "arn:aws:iam::123456789012:role/team-a-kms", true},
+	} {
+		if MatchPath(tc.glob, tc.path) != tc.matches {
+			t.Errorf("Expected MatchPath(%q, %q) to be %v", tc.glob, tc.path, tc.matches)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// RevealCiphertexts makes Ciphertext values format as the ciphertext itself instead of its fingerprint, to debug
+// values that can't be decoded or decrypted. Plaintexts are never logged, with or without it.
+var RevealCiphertexts bool
+
+// Ciphertext is a ciphertext that is formatted as its Fingerprint when logged, printed or encoded as JSON, so that
+// logs and events can tell values apart without including them.
+type Ciphertext string
+
+func (c Ciphertext) String() string {
+	if RevealCiphertexts {
+		return string(c)
+	}
+	return Fingerprint(string(c))
+}
+
+func (c Ciphertext) GoString() string {
+	return c.String()
+}
+
+func (c Ciphertext) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// Fingerprint returns a short identifier of value, which is the prefix of its SHA-256 hash. It's only meant for
+// ciphertexts, since the hash of a low-entropy plaintext can be brute-forced.
+func Fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
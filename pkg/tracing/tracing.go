@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+const instrumentationName = "github.com/patoarvizu/kms-vault-operator"
+
+// Span attributes shared by the operator and the webhook. None of them is ever set to a ciphertext or a plaintext.
+const (
+	NamespaceKey          = attribute.Key("kubernetes.namespace")
+	NameKey               = attribute.Key("kubernetes.name")
+	KindKey               = attribute.Key("kubernetes.kind")
+	SecretKeyKey          = attribute.Key("secret.key")
+	KMSKeyKey             = attribute.Key("kms.key_id")
+	VaultPathKey          = attribute.Key("vault.path")
+	VaultEngineKey        = attribute.Key("vault.engine_version")
+	VaultAuthMethodKey    = attribute.Key("vault.auth_method")
+	AdmissionUIDKey       = attribute.Key("admission.uid")
+	AdmissionOperationKey = attribute.Key("admission.operation")
+	ValidationModeKey     = attribute.Key("validation.mode")
+)
+
+// Setup exports the spans of the process to the OTLP gRPC collector at endpoint, as serviceName, and propagates trace
+// context with the W3C traceparent header. Spans are not recorded if endpoint is empty. The returned function flushes
+// the pending spans and must be called before the process exits.
+func Setup(ctx context.Context, endpoint string, insecure bool, serviceName string) (func(context.Context) error, error) {
+	if len(endpoint) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+	options := []otlpgrpc.Option{otlpgrpc.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlpgrpc.WithInsecure())
+	} else {
+		options = append(options, otlpgrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, "")))
+	}
+	exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(options...))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Start starts a span called name as a child of the one in ctx, if any.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	setError(span, err)
+	span.End()
+}
+
+// RecordError marks the span in ctx as failed with err, if it's not nil.
+func RecordError(ctx context.Context, err error) {
+	setError(trace.SpanFromContext(ctx), err)
+}
+
+// setError records err on span. Only the error message is recorded, so errors must not include secret values.
+func setError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Inject adds the trace context of ctx to the headers of an outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// VaultClient returns a shallow copy of vaultClient that sends the trace context of ctx with every request. Tokens set
+// on the copy are not set on vaultClient.
+func VaultClient(ctx context.Context, vaultClient *vaultapi.Client) *vaultapi.Client {
+	return vaultClient.WithRequestCallbacks(func(r *vaultapi.Request) {
+		if r.Headers == nil {
+			r.Headers = http.Header{}
+		}
+		Inject(ctx, r.Headers)
+	})
+}
+
+// Handler extracts the trace context from the headers of incoming requests, and handles them in a server span called
+// name.
+func Handler(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+)
+
+// checkBundle returns an error if bundle can't be expanded regardless of its plaintext, i.e. if the secret also has a
+// format, or if any of its include or exclude patterns is not valid.
+func checkBundle(secretFormat string, bundle *kmsvaultv1alpha1.Bundle) error {
+	if len(secretFormat) > 0 {
+		return errors.New("has both a format and a bundle, the format of a bundle must be set in bundle.format")
+	}
+	err := format.CheckPatterns(bundle.Include)
+	if err == nil {
+		err = format.CheckPatterns(bundle.Exclude)
+	}
+	return err
+}
+
+// checkValues returns an error if the decrypted plaintext of s can't be written the way the operator would write it,
+// either as the value of s.Key or as the keys of its bundle. The plaintext of a bundle in an envelope is the data key
+// to open it with.
+func checkValues(s kmsvaultv1alpha1.Secret, plaintext []byte, envelope *kmsutil.Envelope) error {
+	values := map[string]interface{}{}
+	if s.Bundle == nil {
+		value, err := format.Parse(s.Format, plaintext)
+		if err != nil {
+			return err
+		}
+		values[s.Key] = value
+	} else {
+		if envelope != nil {
+			var err error
+			plaintext, err = envelope.Open(plaintext)
+			if err != nil {
+				return fmt.Errorf("has an envelope that can't be opened: %v", err)
+			}
+		}
+		var err error
+		values, err = format.ExpandBundle(s.Bundle.Format, plaintext, s.Bundle.Prefix, s.Bundle.Include, s.Bundle.Exclude)
+		if err != nil {
+			return err
+		}
+	}
+	for k, v := range values {
+		_, err := format.Encode(s.OutputEncoding, v)
+		if err != nil {
+			if k != s.Key {
+				return fmt.Errorf("expands to key %s, which %v", k, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
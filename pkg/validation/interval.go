@@ -0,0 +1,22 @@
+package validation
+
+import (
+	"fmt"
+	"time"
+)
+
+// NeverSyncInterval is the spec.syncInterval of objects that are only synced when they change.
+const NeverSyncInterval string = "never"
+
+// SyncInterval parses the spec.syncInterval of a KMSVaultSecret, which must be NeverSyncInterval or a positive
+// duration. It returns 0 for NeverSyncInterval.
+func SyncInterval(syncInterval string) (time.Duration, error) {
+	if syncInterval == NeverSyncInterval {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(syncInterval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("Invalid sync interval %s, it must be a positive duration like 10m or 1h30m, or %s", syncInterval, NeverSyncInterval)
+	}
+	return interval, nil
+}
@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+)
+
+// validateStructure checks a ciphertext without decrypting it: it can't be empty, the keys of its encryption context
+// can't be empty, and if there are allowlists, the key it was encrypted with (as reported by kms:ReEncrypt, which never
+// returns the plaintext) has to be allowed by every one of them. It returns the reason why the ciphertext is not
+// valid, or an empty string if it is.
+func validateStructure(svc kmsiface.KMSAPI, ciphertext []byte, encryptionContext map[string]*string, allowedKeys []kmsutil.KeyAllowlist) (string, error) {
+	if len(ciphertext) == 0 {
+		return "is not a valid KMS ciphertext, it's empty", nil
+	}
+	for k := range encryptionContext {
+		if len(k) == 0 {
+			return "has an encryption context with an empty key", nil
+		}
+	}
+	destinationKeyID := kmsutil.FirstKey(allowedKeys...)
+	if len(destinationKeyID) == 0 {
+		return "", nil
+	}
+	keyID, err := kmsutil.CiphertextKeyID(svc, ciphertext, encryptionContext, destinationKeyID)
+	if err != nil {
+		DecryptMetrics.Rejected(kmsutil.UnknownKey, kmsutil.ErrorReason(err))
+		return "can't be re-encrypted to check its KMS key", nil
+	}
+	for _, allowlist := range allowedKeys {
+		allowed, err := allowlist.Allows(svc, keyID)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			DecryptMetrics.Rejected(keyID, "KMSKeyNotAllowed")
+			return fmt.Sprintf("is encrypted with KMS key %s, which is not allowed", keyID), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,27 @@
+package validation
+
+import (
+	"fmt"
+
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/valuetemplate"
+)
+
+// Templates checks that the spec.templates of secret can be parsed, and that their keys are not written by any of
+// secrets, which are the ones of secret and the PartialKMSVaultSecrets it includes. The keys of bundles are only known
+// once they're decrypted, so they're checked by the operator. Templates are only rendered by the operator, since that
+// needs the plaintexts of every secret. It returns the reason why they're not valid, or an empty string if they are.
+func Templates(secret *kmsvaultv1alpha1.KMSVaultSecret, secrets []kmsvaultv1alpha1.Secret) string {
+	for _, t := range secret.Spec.Templates {
+		for _, s := range secrets {
+			if s.Key == t.Key && !s.TemplateOnly && s.Bundle == nil {
+				return fmt.Sprintf("Template %s in KMSVaultSecret %s has the same key as a secret", t.Key, secret.ObjectMeta.Name)
+			}
+		}
+		_, err := valuetemplate.Parse(t.Key, t.Template)
+		if err != nil {
+			return fmt.Sprintf("Template %s in KMSVaultSecret %s is not valid: %v", t.Key, secret.ObjectMeta.Name, err)
+		}
+	}
+	return ""
+}
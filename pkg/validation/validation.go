@@ -0,0 +1,148 @@
+package validation
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/format"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DecryptMode    string = "decrypt"
+	StructuralMode string = "structural"
+)
+
+// DecryptMetrics records the kms:Decrypt calls made to validate secrets, if set.
+var DecryptMetrics *kmsutil.DecryptMetrics
+
+// Rules are the restrictions that apply to the secrets of an object.
+type Rules struct {
+	// Mode is either DecryptMode or StructuralMode.
+	Mode string
+	// AllowedKeys are the KMS key allowlists that must all allow the key a secret is encrypted with.
+	AllowedKeys []kmsutil.KeyAllowlist
+	// RequiredContext are the keys that must be in the encryption context of a secret.
+	RequiredContext []policy.ContextRequirement
+	// InjectNamespaceContext and InjectNameContext add the entries of kmsutil.ObjectContext to the encryption
+	// context of every secret.
+	InjectNamespaceContext bool
+	InjectNameContext      bool
+}
+
+// Secrets checks that secrets are valid according to rules. Templates in the required encryption context values are
+// rendered for owner, the KMSVaultSecret the secrets are written by. It returns the reason why the secrets are not
+// valid, or an empty string if they are.
+func Secrets(ctx context.Context, svc kmsiface.KMSAPI, kind string, name string, secrets []kmsvaultv1alpha1.Secret, secretContext map[string]string, owner metav1.Object, rules Rules) (string, error) {
+	for _, s := range secrets {
+		if s.EmptySecret {
+			continue
+		}
+		err := format.Check(s.Format, s.OutputEncoding)
+		if err == nil && s.Bundle != nil {
+			err = checkBundle(s.Format, s.Bundle)
+		}
+		if err != nil {
+			return fmt.Sprintf("Key %s in %s %s %v", s.Key, kind, name, err), nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s.EncryptedSecret)
+		var envelope *kmsutil.Envelope
+		if err == nil && s.Bundle != nil && s.Bundle.Envelope {
+			envelope, err = kmsutil.ParseEnvelope(decoded)
+			if err == nil {
+				decoded = envelope.Key
+			}
+		}
+		if err != nil {
+			DecryptMetrics.Rejected(kmsutil.UnknownKey, "DecodingError")
+			return fmt.Sprintf("Error decoding key %s in %s %s", s.Key, kind, name), nil
+		}
+		encryptionContext := ApplicableContext(s.SecretContext, secretContext, InjectedContext(owner, rules))
+		reason, err := policy.CheckContext(rules.RequiredContext, encryptionContext, owner)
+		if err != nil {
+			return "", err
+		}
+		if len(reason) > 0 {
+			DecryptMetrics.Rejected(kmsutil.UnknownKey, "EncryptionContextNotAllowed")
+			return fmt.Sprintf("Key %s in %s %s %s", s.Key, kind, name, reason), nil
+		}
+		if rules.Mode == StructuralMode {
+			reason, err := validateStructure(svc, decoded, encryptionContext, rules.AllowedKeys)
+			if err != nil {
+				return "", err
+			}
+			if len(reason) > 0 {
+				return fmt.Sprintf("Key %s in %s %s %s", s.Key, kind, name, reason), nil
+			}
+			continue
+		}
+		_, span := tracing.Start(ctx, "KMS.Decrypt", tracing.KindKey.String(kind), tracing.NameKey.String(name), tracing.SecretKeyKey.String(s.Key))
+		result, err := DecryptMetrics.Decrypt(svc, &kms.DecryptInput{CiphertextBlob: decoded, EncryptionContext: encryptionContext, KeyId: kmsutil.DecryptKeyID(rules.AllowedKeys...)})
+		if err == nil {
+			span.SetAttributes(tracing.KMSKeyKey.String(aws.StringValue(result.KeyId)))
+		}
+		tracing.End(span, err)
+		if err != nil {
+			return fmt.Sprintf("Error decrypting key %s in %s %s", s.Key, kind, name), nil
+		}
+		for _, allowlist := range rules.AllowedKeys {
+			allowed, err := allowlist.Allows(svc, aws.StringValue(result.KeyId))
+			if err != nil {
+				return "", err
+			}
+			if !allowed {
+				DecryptMetrics.Rejected(aws.StringValue(result.KeyId), "KMSKeyNotAllowed")
+				return fmt.Sprintf("Key %s in %s %s is encrypted with KMS key %s, which is not allowed", s.Key, kind, name, aws.StringValue(result.KeyId)), nil
+			}
+		}
+		err = checkValues(s, result.Plaintext, envelope)
+		if err != nil {
+			return fmt.Sprintf("Key %s in %s %s %v", s.Key, kind, name, err), nil
+		}
+	}
+	return "", nil
+}
+
+// InjectedContext returns the encryption context entries that the operator adds to the secrets written by owner, if
+// enabled. The name of a PartialKMSVaultSecret is never added, since its secrets are decrypted with the name of the
+// KMSVaultSecret that includes it.
+func InjectedContext(owner metav1.Object, rules Rules) map[string]string {
+	if !rules.InjectNamespaceContext {
+		return nil
+	}
+	_, isPartial := owner.(*kmsvaultv1alpha1.PartialKMSVaultSecret)
+	return kmsutil.ObjectContext(owner.GetNamespace(), owner.GetName(), rules.InjectNameContext && !isPartial)
+}
+
+// ApplicableContext returns the encryption context of a secret, which is its own context if set, or the one of the
+// object otherwise, with the injectedContext entries added on top.
+func ApplicableContext(lowerContext map[string]string, higherContext map[string]string, injectedContext map[string]string) map[string]*string {
+	var m map[string]*string
+	if len(lowerContext) > 0 {
+		m = convertContextMap(lowerContext)
+	} else {
+		m = convertContextMap(higherContext)
+	}
+	for k, v := range injectedContext {
+		value := v
+		m[k] = &value
+	}
+	return m
+}
+
+func convertContextMap(context map[string]string) map[string]*string {
+	m := make(map[string]*string)
+	for k, v := range context {
+		value := v
+		m[k] = &value
+	}
+	return m
+}
@@ -0,0 +1,61 @@
+package validation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplicableContextMultipleKeys(t *testing.T) {
+	for name, tc := range map[string]struct {
+		lower    map[string]string
+		higher   map[string]string
+		injected map[string]string
+		expected map[string]string
+	}{
+		"secret context": {
+			lower:    map[string]string{"app": "api", "team": "payments", "env": "prod"},
+			higher:   map[string]string{"ignored": "true"},
+			expected: map[string]string{"app": "api", "team": "payments", "env": "prod"},
+		},
+		"object context": {
+			higher:   map[string]string{"app": "api", "team": "payments"},
+			injected: map[string]string{"kubernetes_namespace": "default", "kubernetes_name": "test"},
+			expected: map[string]string{"app": "api", "team": "payments", "kubernetes_namespace": "default", "kubernetes_name": "test"},
+		},
+	} {
+		context := aws.StringValueMap(ApplicableContext(tc.lower, tc.higher, tc.injected))
+		if len(context) != len(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, context)
+			continue
+		}
+		for k, v := range tc.expected {
+			if context[k] != v {
+				t.Errorf("%s: expected %s to be %s, got %s", name, k, v, context[k])
+			}
+		}
+	}
+}
+
+func TestInjectedContext(t *testing.T) {
+	secret := &kmsvaultv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "app"}}
+	partial := &kmsvaultv1alpha1.PartialKMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "shared"}}
+	for name, tc := range map[string]struct {
+		owner    metav1.Object
+		rules    Rules
+		expected map[string]string
+	}{
+		"disabled":                {secret, Rules{}, nil},
+		"name requires namespace": {secret, Rules{InjectNameContext: true}, nil},
+		"namespace":               {secret, Rules{InjectNamespaceContext: true}, map[string]string{"kubernetes_namespace": "team-a"}},
+		"name":                    {secret, Rules{InjectNamespaceContext: true, InjectNameContext: true}, map[string]string{"kubernetes_namespace": "team-a", "kubernetes_name": "app"}},
+		"partial":                 {partial, Rules{InjectNamespaceContext: true, InjectNameContext: true}, map[string]string{"kubernetes_namespace": "team-a"}},
+	} {
+		if context := InjectedContext(tc.owner, tc.rules); !reflect.DeepEqual(context, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, context)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	"github.com/patoarvizu/kms-vault-operator/pkg/policy"
+	"github.com/patoarvizu/kms-vault-operator/pkg/tracing"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// KMSClients returns the KMS client to use for a ClientConfig, like kmsutil.ClientCache.Client.
+type KMSClients func(kmsutil.ClientConfig) kmsiface.KMSAPI
+
+// Validator runs the checks of the validating webhook on KMSVaultSecrets and PartialKMSVaultSecrets. The objects they
+// refer to (included partials, KMSVaultNamespaceConfigs and KMSVaultPolicies) are looked up with Client.
+type Validator struct {
+	Client     client.Client
+	KMSClients KMSClients
+	// Rules are the cluster-wide rules, before adding the ones from KMSVaultNamespaceConfigs and KMSVaultPolicies.
+	Rules              Rules
+	PathPrefixTemplate string
+}
+
+// KMSVaultSecret checks that secret has a valid sync interval, that it's allowed by the policies that apply to it, and
+// that its secrets and the ones of the PartialKMSVaultSecrets it includes are valid. It returns the reason why it's not
+// valid, or an empty string if it is.
+func (v *Validator) KMSVaultSecret(ctx context.Context, secret *kmsvaultv1alpha1.KMSVaultSecret) (reason string, err error) {
+	ctx, span := tracing.Start(ctx, "ValidateKMSVaultSecret", tracing.NamespaceKey.String(secret.Namespace), tracing.NameKey.String(secret.Name), tracing.ValidationModeKey.String(v.Rules.Mode))
+	defer func() { tracing.End(span, err) }()
+	rules, err := v.NamespaceRules(ctx, secret.Namespace)
+	if err != nil {
+		return "", err
+	}
+	if len(secret.Spec.SyncInterval) > 0 {
+		if _, err := SyncInterval(secret.Spec.SyncInterval); err != nil {
+			return fmt.Sprintf("KMSVaultSecret %s is not valid: %v", secret.ObjectMeta.Name, err), nil
+		}
+	}
+	target, err := policy.SecretTarget(secret, v.PathPrefixTemplate)
+	if err != nil {
+		return fmt.Sprintf("KMSVaultSecret %s is not valid: %v", secret.ObjectMeta.Name, err), nil
+	}
+	decision, err := policy.Evaluate(ctx, v.Client, target)
+	if err != nil {
+		return "", err
+	}
+	if !decision.Allowed {
+		return fmt.Sprintf("KMSVaultSecret %s is not allowed: %s", secret.ObjectMeta.Name, decision.Message), nil
+	}
+	rules.AllowedKeys = append(rules.AllowedKeys, decision.AllowedKMSKeys)
+	svc := v.KMSClients(ClientConfig(secret))
+	reason, err = Secrets(ctx, svc, "KMSVaultSecret", secret.ObjectMeta.Name, secret.Spec.Secrets, secret.Spec.SecretContext, secret, rules)
+	if err != nil || len(reason) > 0 {
+		return reason, err
+	}
+	allSecrets := append([]kmsvaultv1alpha1.Secret{}, secret.Spec.Secrets...)
+	for _, partialName := range secret.Spec.IncludeSecrets {
+		partial := &kmsvaultv1alpha1.PartialKMSVaultSecret{}
+		_, partialSpan := tracing.Start(ctx, "ResolvePartial", tracing.NamespaceKey.String(secret.Namespace), tracing.NameKey.String(partialName))
+		err = v.Client.Get(ctx, client.ObjectKey{Namespace: secret.Namespace, Name: partialName}, partial)
+		tracing.End(partialSpan, client.IgnoreNotFound(err))
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("PartialKMSVaultSecret %s included by KMSVaultSecret %s doesn't exist", partialName, secret.ObjectMeta.Name), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		// Like the controller, the secrets of a partial are decrypted with the context of the KMSVaultSecret.
+		reason, err = Secrets(ctx, svc, "PartialKMSVaultSecret", partialName, partial.Spec.Secrets, secret.Spec.SecretContext, secret, rules)
+		if err != nil || len(reason) > 0 {
+			return reason, err
+		}
+		allSecrets = append(allSecrets, partial.Spec.Secrets...)
+	}
+	return Templates(secret, allSecrets), nil
+}
+
+// PartialKMSVaultSecret checks that the secrets of partial can be decrypted with the KMS settings and encryption context
+// of every KMSVaultSecret in includedBy, or with the default settings and its own context if it's empty. It returns
+// the reason why it's not valid, or an empty string if it is.
+func (v *Validator) PartialKMSVaultSecret(ctx context.Context, partial *kmsvaultv1alpha1.PartialKMSVaultSecret, includedBy []kmsvaultv1alpha1.KMSVaultSecret) (reason string, err error) {
+	ctx, span := tracing.Start(ctx, "ValidatePartialKMSVaultSecret", tracing.NamespaceKey.String(partial.Namespace), tracing.NameKey.String(partial.Name), tracing.ValidationModeKey.String(v.Rules.Mode))
+	defer func() { tracing.End(span, err) }()
+	rules, err := v.NamespaceRules(ctx, partial.Namespace)
+	if err != nil {
+		return "", err
+	}
+	if len(includedBy) == 0 {
+		return Secrets(ctx, v.KMSClients(kmsutil.ClientConfig{}), "PartialKMSVaultSecret", partial.ObjectMeta.Name, partial.Spec.Secrets, partial.Spec.SecretContext, partial, rules)
+	}
+	for i := range includedBy {
+		secret := &includedBy[i]
+		allowed, err := v.allowed(ctx, secret)
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			// The secrets of an object that isn't allowed are never decrypted, and its role mustn't be assumed.
+			continue
+		}
+		reason, err := Secrets(ctx, v.KMSClients(ClientConfig(secret)), "PartialKMSVaultSecret", partial.ObjectMeta.Name, partial.Spec.Secrets, secret.Spec.SecretContext, secret, rules)
+		if err != nil || len(reason) > 0 {
+			return reason, err
+		}
+		reason = Templates(secret, partial.Spec.Secrets)
+		if len(reason) > 0 {
+			return fmt.Sprintf("PartialKMSVaultSecret %s can't be included: %s", partial.ObjectMeta.Name, reason), nil
+		}
+	}
+	return "", nil
+}
+
+// allowed reports whether secret is allowed by the policies that apply to it.
+func (v *Validator) allowed(ctx context.Context, secret *kmsvaultv1alpha1.KMSVaultSecret) (bool, error) {
+	target, err := policy.SecretTarget(secret, v.PathPrefixTemplate)
+	if err != nil {
+		return false, nil
+	}
+	decision, err := policy.Evaluate(ctx, v.Client, target)
+	return decision.Allowed, err
+}
+
+// IncludingSecrets returns the KMSVaultSecrets that include partial, except for the ones that are being deleted, since
+// they won't decrypt it again.
+func (v *Validator) IncludingSecrets(ctx context.Context, partial *kmsvaultv1alpha1.PartialKMSVaultSecret) ([]kmsvaultv1alpha1.KMSVaultSecret, error) {
+	secrets := &kmsvaultv1alpha1.KMSVaultSecretList{}
+	err := v.Client.List(ctx, secrets, client.InNamespace(partial.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	includedBy := []kmsvaultv1alpha1.KMSVaultSecret{}
+	for _, s := range secrets.Items {
+		if s.DeletionTimestamp != nil {
+			continue
+		}
+		for _, i := range s.Spec.IncludeSecrets {
+			if i == partial.Name {
+				includedBy = append(includedBy, s)
+				break
+			}
+		}
+	}
+	return includedBy, nil
+}
+
+// NamespaceRules returns the cluster-wide rules, combined with the ones from the KMSVaultNamespaceConfigs in
+// namespace.
+func (v *Validator) NamespaceRules(ctx context.Context, namespace string) (Rules, error) {
+	namespaceConfigs := &kmsvaultv1alpha1.KMSVaultNamespaceConfigList{}
+	err := v.Client.List(ctx, namespaceConfigs, client.InNamespace(namespace))
+	if err != nil {
+		return Rules{}, err
+	}
+	namespaceAllowedKeys := kmsutil.KeyAllowlist{}
+	requiredContextKeys := []string{}
+	for _, c := range namespaceConfigs.Items {
+		namespaceAllowedKeys = append(namespaceAllowedKeys, c.Spec.AllowedKMSKeys...)
+		requiredContextKeys = append(requiredContextKeys, c.Spec.RequiredContextKeys...)
+	}
+	rules := v.Rules
+	rules.AllowedKeys = append(append([]kmsutil.KeyAllowlist{}, v.Rules.AllowedKeys...), namespaceAllowedKeys)
+	rules.RequiredContext = append(append([]policy.ContextRequirement{}, v.Rules.RequiredContext...), policy.ParseContextRequirements(requiredContextKeys)...)
+	return rules, nil
+}
+
+// ClientConfig returns the KMS client configuration that the secrets of secret are decrypted with.
+func ClientConfig(secret *kmsvaultv1alpha1.KMSVaultSecret) kmsutil.ClientConfig {
+	return kmsutil.ClientConfig{
+		Region:     secret.Spec.KMS.Region,
+		RoleARN:    secret.Spec.KMS.RoleARN,
+		ExternalID: secret.Spec.KMS.ExternalID,
+	}
+}
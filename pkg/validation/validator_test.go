@@ -0,0 +1,184 @@
+package validation
+
+import (
+	"context"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	kmsvaultv1alpha1 "github.com/patoarvizu/kms-vault-operator/api/v1alpha1"
+	"github.com/patoarvizu/kms-vault-operator/pkg/kmsutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const testKMSKey = "arn:aws:kms:us-east-1:123456789012:key/11111111-2222-3333-4444-555555555555"
+
+// contextKMS decrypts any ciphertext, as long as it's decrypted with context as its encryption context.
+type contextKMS struct {
+	kmsiface.KMSAPI
+	context map[string]string
+}
+
+func (k contextKMS) Decrypt(input *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	if !reflect.DeepEqual(aws.StringValueMap(input.EncryptionContext), k.context) {
+		return nil, awserr.New(kms.ErrCodeInvalidCiphertextException, "", nil)
+	}
+	return &kms.DecryptOutput{Plaintext: []byte("value"), KeyId: aws.String(testKMSKey)}, nil
+}
+
+func testValidator(t *testing.T, objects ...client.Object) *Validator {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kmsvaultv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := contextKMS{context: map[string]string{"app": "api"}}
+	return &Validator{
+		Client:     fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		KMSClients: func(kmsutil.ClientConfig) kmsiface.KMSAPI { return svc },
+		Rules:      Rules{Mode: DecryptMode},
+	}
+}
+
+func testSecrets() []kmsvaultv1alpha1.Secret {
+	return []kmsvaultv1alpha1.Secret{{Key: "password", EncryptedSecret: base64.StdEncoding.EncodeToString([]byte("ciphertext"))}}
+}
+
+func TestValidatePartialsWithTheContextOfTheIncluder(t *testing.T) {
+	partial := &kmsvaultv1alpha1.PartialKMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "partial"},
+		Spec:       kmsvaultv1alpha1.PartialKMSVaultSecretSpec{Secrets: testSecrets(), SecretContext: map[string]string{"app": "ignored"}},
+	}
+	secret := &kmsvaultv1alpha1.KMSVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: kmsvaultv1alpha1.KMSVaultSecretSpec{
+			Path:           "secret/app",
+			Secrets:        testSecrets(),
+			SecretContext:  map[string]string{"app": "api"},
+			IncludeSecrets: []string{"partial"},
+		},
+	}
+	v := testValidator(t, partial, secret)
+	reason, err := v.KMSVaultSecret(context.Background(), secret)
+	if err != nil || len(reason) > 0 {
+		t.Errorf("Expected the partial to be decrypted with the context of the KMSVaultSecret, got %q, %v", reason, err)
+	}
+	includedBy, err := v.IncludingSecrets(context.Background(), partial)
+	if err != nil || len(includedBy) != 1 {
+		t.Fatalf("Expected the partial to be included by one object, got %v, %v", includedBy, err)
+	}
+	reason, err = v.PartialKMSVaultSecret(context.Background(), partial, includedBy)
+	if err != nil || len(reason) > 0 {
+		t.Errorf("Expected the partial to be decrypted with the context of the KMSVaultSecret, got %q, %v", reason, err)
+	}
+	reason, err = v.PartialKMSVaultSecret(context.Background(), partial, nil)
+	if err != nil || !strings.Contains(reason, "Error decrypting key password") {
+		t.Errorf("Expected a partial that isn't included to be decrypted with its own context, got %q, %v", reason, err)
+	}
+}
+
+func TestIncludingSecretsSkipsDeletedObjects(t *testing.T) {
+	partial := &kmsvaultv1alpha1.PartialKMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "partial"}}
+	now := metav1.Now()
+	includer := func(name string, deletionTimestamp *metav1.Time) *kmsvaultv1alpha1.KMSVaultSecret {
+		return &kmsvaultv1alpha1.KMSVaultSecret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, DeletionTimestamp: deletionTimestamp, Finalizers: []string{"delete.k8s.patoarvizu.dev"}},
+			Spec:       kmsvaultv1alpha1.KMSVaultSecretSpec{IncludeSecrets: []string{"partial"}},
+		}
+	}
+	v := testValidator(t, partial, includer("active", nil), includer("deleted", &now))
+	includedBy, err := v.IncludingSecrets(context.Background(), partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(includedBy) != 1 || includedBy[0].Name != "active" {
+		t.Errorf("Expected only the object that isn't being deleted, got %v", includedBy)
+	}
+}
+
+// failingKMS panics on every call, to check that nothing calls KMS.
+type failingKMS struct {
+	kmsiface.KMSAPI
+}
+
+// sourceKeyKMS re-encrypts every ciphertext from the key sourceKeyID, and resolves aliases to it.
+type sourceKeyKMS struct {
+	kmsiface.KMSAPI
+	sourceKeyID string
+}
+
+func (k sourceKeyKMS) ReEncrypt(input *kms.ReEncryptInput) (*kms.ReEncryptOutput, error) {
+	return &kms.ReEncryptOutput{SourceKeyId: aws.String(k.sourceKeyID), KeyId: input.DestinationKeyId}, nil
+}
+
+func (k sourceKeyKMS) DescribeKey(input *kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error) {
+	return &kms.DescribeKeyOutput{KeyMetadata: &kms.KeyMetadata{Arn: aws.String("arn:aws:kms:us-east-1:123456789012:key/" + strings.TrimPrefix(aws.StringValue(input.KeyId), "alias/"))}}, nil
+}
+
+func TestStructuralMode(t *testing.T) {
+	secrets := []kmsvaultv1alpha1.Secret{{Key: "password", EncryptedSecret: base64.StdEncoding.EncodeToString([]byte("ciphertext"))}}
+	owner := &kmsvaultv1alpha1.KMSVaultSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	reason, err := Secrets(context.Background(), failingKMS{}, "KMSVaultSecret", "app", secrets, nil, owner, Rules{Mode: StructuralMode})
+	if err != nil || len(reason) > 0 {
+		t.Errorf("Expected a ciphertext to be valid without calling KMS if no keys are restricted, got %q, %v", reason, err)
+	}
+	allowed := Rules{Mode: StructuralMode, AllowedKeys: []kmsutil.KeyAllowlist{{"alias/app"}, {}}}
+	reason, err = Secrets(context.Background(), sourceKeyKMS{sourceKeyID: "arn:aws:kms:us-east-1:123456789012:key/app"}, "KMSVaultSecret", "app", secrets, nil, owner, allowed)
+	if err != nil || len(reason) > 0 {
+		t.Errorf("Expected a ciphertext encrypted with an allowed key to be valid, got %q, %v", reason, err)
+	}
+	for name, tc := range map[string]struct {
+		secret   kmsvaultv1alpha1.Secret
+		svc      kmsiface.KMSAPI
+		expected string
+	}{
+		"empty":           {kmsvaultv1alpha1.Secret{Key: "password", EncryptedSecret: ""}, failingKMS{}, "is not a valid KMS ciphertext"},
+		"empty context":   {kmsvaultv1alpha1.Secret{Key: "password", EncryptedSecret: secrets[0].EncryptedSecret, SecretContext: map[string]string{"": "value"}}, failingKMS{}, "empty key"},
+		"key not allowed": {secrets[0], sourceKeyKMS{sourceKeyID: "arn:aws:kms:us-east-1:123456789012:key/other"}, "key/other, which is not allowed"},
+	} {
+		reason, err := Secrets(context.Background(), tc.svc, "KMSVaultSecret", "app", []kmsvaultv1alpha1.Secret{tc.secret}, nil, owner, allowed)
+		if err != nil || !strings.Contains(reason, tc.expected) {
+			t.Errorf("%s: expected a reason with %q, got %q, %v", name, tc.expected, reason, err)
+		}
+	}
+}
+
+func TestValidateSyncInterval(t *testing.T) {
+	for syncInterval, valid := range map[string]bool{
+		"":      true,
+		"10m":   true,
+		"never": true,
+		"0s":    false,
+		"-10m":  false,
+		"10x":   false,
+	} {
+		secret := &kmsvaultv1alpha1.KMSVaultSecret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+			Spec: kmsvaultv1alpha1.KMSVaultSecretSpec{
+				Path:          "secret/app",
+				Secrets:       testSecrets(),
+				SecretContext: map[string]string{"app": "api"},
+				SyncInterval:  syncInterval,
+			},
+		}
+		reason, err := testValidator(t, secret).KMSVaultSecret(context.Background(), secret)
+		if err != nil {
+			t.Errorf("%q: %v", syncInterval, err)
+		} else if valid && len(reason) > 0 {
+			t.Errorf("%q: expected the sync interval to be valid, got %q", syncInterval, reason)
+		} else if !valid && !strings.Contains(reason, "sync interval") {
+			t.Errorf("%q: expected the sync interval to be rejected, got %q", syncInterval, reason)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package valuetemplate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// FuncMap holds the functions that value templates can use on top of the built-in ones of text/template. They follow
+// the names and argument order of their sprig counterparts, so they can be used at the end of a pipeline, e.g.
+// {{ .password | queryEscape }} or {{ .user | default "admin" }}.
+var FuncMap = template.FuncMap{
+	"default":     defaultValue,
+	"required":    required,
+	"upper":       strings.ToUpper,
+	"lower":       strings.ToLower,
+	"trim":        strings.TrimSpace,
+	"trimPrefix":  func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix":  func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":     func(old string, new string, s string) string { return strings.ReplaceAll(s, old, new) },
+	"quote":       func(s string) string { return fmt.Sprintf("%q", s) },
+	"squote":      func(s string) string { return "'" + s + "'" },
+	"join":        join,
+	"indent":      indent,
+	"nindent":     func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+	"b64enc":      func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec":      b64dec,
+	"toJson":      toJSON,
+	"sha256sum":   func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+	"pathEscape":  url.PathEscape,
+	"queryEscape": url.QueryEscape,
+}
+
+// Parse parses text as the template of the value written to key.
+func Parse(key string, text string) (*template.Template, error) {
+	return template.New(key).Option("missingkey=error").Funcs(FuncMap).Parse(text)
+}
+
+// Render renders text, the template of the value written to key, with values, the decrypted values of the secret by
+// key. Referring to a key that is not in values is an error, and so is a result that is not valid UTF-8.
+func Render(key string, text string, values map[string]interface{}) (string, error) {
+	t, err := Parse(key, text)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	err = t.Execute(&rendered, values)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(rendered.Bytes()) {
+		return "", errors.New("rendered a value that is not valid UTF-8, use b64enc to write binary values")
+	}
+	return rendered.String(), nil
+}
+
+// IsMissingKey reports whether err is the error of Render for a template that refers to a key that is not in values.
+func IsMissingKey(err error) bool {
+	var execErr template.ExecError
+	return errors.As(err, &execErr) && strings.Contains(execErr.Error(), "map has no entry for key")
+}
+
+func defaultValue(def interface{}, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice:
+		if v.Len() == 0 {
+			return def
+		}
+	}
+	return value
+}
+
+func required(message string, value interface{}) (interface{}, error) {
+	if s, ok := value.(string); value == nil || (ok && len(s) == 0) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+func join(sep string, list interface{}) (string, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice {
+		return "", fmt.Errorf("join can't be used on a %s", v.Kind())
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(items, sep), nil
+}
+
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// b64dec doesn't include the value in its error, since it's usually a secret.
+func b64dec(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", errors.New("b64dec was given a value that is not valid base64")
+	}
+	return string(decoded), nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	j, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.New("toJson was given a value that can't be encoded as JSON")
+	}
+	return string(j), nil
+}
@@ -1,3 +1,246 @@
+resource "kubernetes_manifest" "customresourcedefinition_kmsvaultnamespaceconfigs_k8s_patoarvizu_dev" {
+  manifest = {
+    "apiVersion" = "apiextensions.k8s.io/v1"
+    "kind" = "CustomResourceDefinition"
+    "metadata" = {
+      "annotations" = {
+        "controller-gen.kubebuilder.io/version" = "v0.7.0"
+      }
+      "name" = "kmsvaultnamespaceconfigs.k8s.patoarvizu.dev"
+    }
+    "spec" = {
+      "group" = "k8s.patoarvizu.dev"
+      "names" = {
+        "kind" = "KMSVaultNamespaceConfig"
+        "listKind" = "KMSVaultNamespaceConfigList"
+        "plural" = "kmsvaultnamespaceconfigs"
+        "shortNames" = [
+          "kmsvnc",
+        ]
+        "singular" = "kmsvaultnamespaceconfig"
+      }
+      "scope" = "Namespaced"
+      "versions" = [
+        {
+          "name" = "v1alpha1"
+          "schema" = {
+            "openAPIV3Schema" = {
+              "description" = "KMSVaultNamespaceConfig is the Schema for the kmsvaultnamespaceconfigs API"
+              "properties" = {
+                "apiVersion" = {
+                  "description" = "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources"
+                  "type" = "string"
+                }
+                "kind" = {
+                  "description" = "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds"
+                  "type" = "string"
+                }
+                "metadata" = {
+                  "type" = "object"
+                }
+                "spec" = {
+                  "description" = "KMSVaultNamespaceConfigSpec defines the settings that apply to all KMSVaultSecrets in the same namespace"
+                  "properties" = {
+                    "allowedKMSKeys" = {
+                      "items" = {
+                        "type" = "string"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-type" = "set"
+                    }
+                    "defaults" = {
+                      "description" = "KMSVaultSecretDefaults are applied by the mutating webhook to the KMSVaultSecrets created in the namespace, and take precedence over the cluster-wide defaults of the webhook."
+                      "properties" = {
+                        "addDeleteFinalizer" = {
+                          "description" = "AddDeleteFinalizer adds the delete.k8s.patoarvizu.dev finalizer, so secrets are removed from Vault when the object is deleted."
+                          "type" = "boolean"
+                        }
+                        "detectEngineVersion" = {
+                          "description" = "DetectEngineVersion looks up the KV engine version of the mount of the path in Vault."
+                          "type" = "boolean"
+                        }
+                        "engineVersion" = {
+                          "description" = "EngineVersion is the KV engine version set on objects that don't set one, if it can't be detected from the mount of their path."
+                          "enum" = [
+                            "v1",
+                            "v2",
+                          ]
+                          "type" = "string"
+                        }
+                        "labels" = {
+                          "additionalProperties" = {
+                            "type" = "string"
+                          }
+                          "description" = "Labels are added to objects that don't already set them, e.g. to identify the team that owns them."
+                          "type" = "object"
+                        }
+                      }
+                      "type" = "object"
+                    }
+                    "requiredContextKeys" = {
+                      "description" = "RequiredContextKeys are keys that must be in the encryption context of every secret in the namespace, in the form key or key=value, where value can be a template like {{ .Namespace }} or {{ .Labels.app }}."
+                      "items" = {
+                        "type" = "string"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-type" = "set"
+                    }
+                  }
+                  "type" = "object"
+                }
+              }
+              "type" = "object"
+            }
+          }
+          "served" = true
+          "storage" = true
+        },
+      ]
+    }
+  }
+  field_manager {
+    force_conflicts = true
+  }
+}
+
+resource "kubernetes_manifest" "customresourcedefinition_kmsvaultpolicies_k8s_patoarvizu_dev" {
+  manifest = {
+    "apiVersion" = "apiextensions.k8s.io/v1"
+    "kind" = "CustomResourceDefinition"
+    "metadata" = {
+      "annotations" = {
+        "controller-gen.kubebuilder.io/version" = "v0.7.0"
+      }
+      "name" = "kmsvaultpolicies.k8s.patoarvizu.dev"
+    }
+    "spec" = {
+      "group" = "k8s.patoarvizu.dev"
+      "names" = {
+        "kind" = "KMSVaultPolicy"
+        "listKind" = "KMSVaultPolicyList"
+        "plural" = "kmsvaultpolicies"
+        "shortNames" = [
+          "kmsvp",
+        ]
+        "singular" = "kmsvaultpolicy"
+      }
+      "scope" = "Cluster"
+      "versions" = [
+        {
+          "name" = "v1alpha1"
+          "schema" = {
+            "openAPIV3Schema" = {
+              "description" = "KMSVaultPolicy is the Schema for the kmsvaultpolicies API"
+              "properties" = {
+                "apiVersion" = {
+                  "description" = "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources"
+                  "type" = "string"
+                }
+                "kind" = {
+                  "description" = "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds"
+                  "type" = "string"
+                }
+                "metadata" = {
+                  "type" = "object"
+                }
+                "spec" = {
+                  "description" = "KMSVaultPolicySpec defines which Vault paths, KV engines and KMS keys can be used by the KMSVaultSecrets in the namespaces selected by the policy"
+                  "properties" = {
+                    "allowedEngineVersions" = {
+                      "description" = "AllowedEngineVersions is the list of KV engine versions that can be used. An empty list allows any version."
+                      "items" = {
+                        "enum" = [
+                          "v1",
+                          "v2",
+                        ]
+                        "type" = "string"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-type" = "set"
+                    }
+                    "allowedKMSKeys" = {
+                      "items" = {
+                        "type" = "string"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-type" = "set"
+                    }
+                    "allowedKMSRoleARNs" = {
+                      "description" = "AllowedKMSRoleARNs is a list of globs of the IAM roles that KMSVaultSecrets can assume with spec.kms.roleArn, with the same syntax as AllowedPaths. A KMSVaultSecret can only set a role if it's allowed by a policy that applies to it."
+                      "items" = {
+                        "type" = "string"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-type" = "set"
+                    }
+                    "allowedPaths" = {
+                      "description" = "AllowedPaths is a list of globs of the Vault paths that can be written to, where '*' matches any characters within a path segment and '**' matches across segments. An empty list allows any path."
+                      "items" = {
+                        "type" = "string"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-type" = "set"
+                    }
+                    "namespaceSelector" = {
+                      "description" = "NamespaceSelector selects the namespaces the policy applies to. An empty selector selects all namespaces."
+                      "properties" = {
+                        "matchExpressions" = {
+                          "description" = "matchExpressions is a list of label selector requirements. The requirements are ANDed."
+                          "items" = {
+                            "description" = "A label selector requirement is a selector that contains values, a key, and an operator that relates the key and values."
+                            "properties" = {
+                              "key" = {
+                                "description" = "key is the label key that the selector applies to."
+                                "type" = "string"
+                              }
+                              "operator" = {
+                                "description" = "operator represents a key's relationship to a set of values. Valid operators are In, NotIn, Exists and DoesNotExist."
+                                "type" = "string"
+                              }
+                              "values" = {
+                                "description" = "values is an array of string values. If the operator is In or NotIn, the values array must be non-empty. If the operator is Exists or DoesNotExist, the values array must be empty. This array is replaced during a strategic merge patch."
+                                "items" = {
+                                  "type" = "string"
+                                }
+                                "type" = "array"
+                              }
+                            }
+                            "required" = [
+                              "key",
+                              "operator",
+                            ]
+                            "type" = "object"
+                          }
+                          "type" = "array"
+                        }
+                        "matchLabels" = {
+                          "additionalProperties" = {
+                            "type" = "string"
+                          }
+                          "description" = "matchLabels is a map of {key,value} pairs. A single {key,value} in the matchLabels map is equivalent to an element of matchExpressions, whose key field is \"key\", the operator is \"In\", and the values array contains only \"value\". The requirements are ANDed."
+                          "type" = "object"
+                        }
+                      }
+                      "type" = "object"
+                    }
+                  }
+                  "type" = "object"
+                }
+              }
+              "type" = "object"
+            }
+          }
+          "served" = true
+          "storage" = true
+        },
+      ]
+    }
+  }
+  field_manager {
+    force_conflicts = true
+  }
+}
+
 resource "kubernetes_manifest" "customresourcedefinition_kmsvaultsecrets_k8s_patoarvizu_dev" {
   manifest = {
     "apiVersion" = "apiextensions.k8s.io/v1"
@@ -48,6 +291,22 @@ resource "kubernetes_manifest" "customresourcedefinition_kmsvaultsecrets_k8s_pat
                       "type" = "array"
                       "x-kubernetes-list-type" = "set"
                     }
+                    "kms" = {
+                      "description" = "KMSSettings controls which region and credentials are used to decrypt the secrets. If not set, the region and credentials of the operator are used."
+                      "properties" = {
+                        "externalId" = {
+                          "type" = "string"
+                        }
+                        "region" = {
+                          "type" = "string"
+                        }
+                        "roleArn" = {
+                          "pattern" = "^arn:aws[a-z-]*:iam::[0-9]{12}:role/.+$"
+                          "type" = "string"
+                        }
+                      }
+                      "type" = "object"
+                    }
                     "kvSettings" = {
                       "properties" = {
                         "casIndex" = {
@@ -55,6 +314,7 @@ resource "kubernetes_manifest" "customresourcedefinition_kmsvaultsecrets_k8s_pat
                           "type" = "integer"
                         }
                         "engineVersion" = {
+                          "description" = "EngineVersion is the version of the KV engine mounted on the path. If not set, the mutating webhook sets it from its defaults, otherwise v1 is assumed."
                           "enum" = [
                             "v1",
                             "v2",
@@ -62,12 +322,10 @@ resource "kubernetes_manifest" "customresourcedefinition_kmsvaultsecrets_k8s_pat
                           "type" = "string"
                         }
                       }
-                      "required" = [
-                        "engineVersion",
-                      ]
                       "type" = "object"
                     }
                     "path" = {
+                      "description" = "Path is the Vault path the secret is written to. It's rendered as a Go template that can refer to {{ .Namespace }}, {{ .Name }}, {{ .Labels }} and {{ .Annotations }} of the object."
                       "type" = "string"
                     }
                     "secretContext" = {
@@ -79,21 +337,83 @@ resource "kubernetes_manifest" "customresourcedefinition_kmsvaultsecrets_k8s_pat
                     "secrets" = {
                       "items" = {
                         "properties" = {
+                          "bundle" = {
+                            "description" = "Bundle makes the plaintext a document whose keys are written as separate secrets, instead of writing the plaintext to Key."
+                            "properties" = {
+                              "envelope" = {
+                                "description" = "Envelope is set if encryptedSecret is an envelope, i.e. a document encrypted with a data key that is encrypted with KMS, for documents larger than what KMS can encrypt directly."
+                                "type" = "boolean"
+                              }
+                              "exclude" = {
+                                "description" = "Exclude are glob patterns of the keys that are not written, even if they match Include."
+                                "items" = {
+                                  "type" = "string"
+                                }
+                                "type" = "array"
+                              }
+                              "format" = {
+                                "description" = "Format is the format of the document."
+                                "enum" = [
+                                  "dotenv",
+                                  "json",
+                                  "yaml",
+                                ]
+                                "type" = "string"
+                              }
+                              "include" = {
+                                "description" = "Include are glob patterns of the keys that are written. If empty, every key is written."
+                                "items" = {
+                                  "type" = "string"
+                                }
+                                "type" = "array"
+                              }
+                              "prefix" = {
+                                "description" = "Prefix is added to the key of every secret of the bundle."
+                                "type" = "string"
+                              }
+                            }
+                            "required" = [
+                              "format",
+                            ]
+                            "type" = "object"
+                          }
                           "emptySecret" = {
                             "type" = "boolean"
                           }
                           "encryptedSecret" = {
                             "type" = "string"
                           }
+                          "format" = {
+                            "description" = "Format is how the plaintext is parsed before it's written to Vault. A string is written as is, json and yaml are written as the object, list, number, etc. that they hold, and base64 is decoded and written as a string."
+                            "enum" = [
+                              "string",
+                              "json",
+                              "yaml",
+                              "base64",
+                            ]
+                            "type" = "string"
+                          }
                           "key" = {
                             "type" = "string"
                           }
+                          "outputEncoding" = {
+                            "description" = "OutputEncoding is how the value is written to Vault. With raw, it's written as is, and has to be valid UTF-8. With base64, it's written base64-encoded, which is how binary values are written. It can only be base64 if the format is string or base64."
+                            "enum" = [
+                              "raw",
+                              "base64",
+                            ]
+                            "type" = "string"
+                          }
                           "secretContext" = {
                             "additionalProperties" = {
                               "type" = "string"
                             }
                             "type" = "object"
                           }
+                          "templateOnly" = {
+                            "description" = "TemplateOnly keeps the secret out of the data written to Vault, so it's only used by templates."
+                            "type" = "boolean"
+                          }
                         }
                         "required" = [
                           "key",
@@ -106,9 +426,39 @@ resource "kubernetes_manifest" "customresourcedefinition_kmsvaultsecrets_k8s_pat
                       ]
                       "x-kubernetes-list-type" = "map"
                     }
+                    "syncInterval" = {
+                      "description" = "SyncInterval is the amount of time between syncs, as a duration like 10m or 1h30m, or never to only sync when the object changes. It's kept within the limits set on the operator, and defaults to its --sync-period-seconds."
+                      "pattern" = "^(never|([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+)$"
+                      "type" = "string"
+                    }
+                    "templates" = {
+                      "description" = "Templates are values composed from the decrypted secrets of the object and the PartialKMSVaultSecrets it includes."
+                      "items" = {
+                        "description" = "Template is a value that is rendered from the decrypted secrets."
+                        "properties" = {
+                          "key" = {
+                            "description" = "Key is the key the rendered value is written to."
+                            "type" = "string"
+                          }
+                          "template" = {
+                            "description" = "Template is a Go template that can refer to the decrypted secrets by key, e.g. {{ .password }}. Secrets with the json or yaml format can be referred to by field, e.g. {{ .database.user }}."
+                            "type" = "string"
+                          }
+                        }
+                        "required" = [
+                          "key",
+                          "template",
+                        ]
+                        "type" = "object"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-map-keys" = [
+                        "key",
+                      ]
+                      "x-kubernetes-list-type" = "map"
+                    }
                   }
                   "required" = [
-                    "kvSettings",
                     "path",
                     "secrets",
                   ]
@@ -117,9 +467,83 @@ resource "kubernetes_manifest" "customresourcedefinition_kmsvaultsecrets_k8s_pat
                 "status" = {
                   "description" = "KMSVaultSecretStatus defines the observed state of KMSVaultSecret"
                   "properties" = {
+                    "conditions" = {
+                      "items" = {
+                        "description" = "Condition contains details for one aspect of the current state of this API Resource. --- This struct is intended for direct use as an array at the field path .status.conditions.  For example, type FooStatus struct{     // Represents the observations of a foo's current state.     // Known .status.conditions.type are: \"Available\", \"Progressing\", and \"Degraded\"     // +patchMergeKey=type     // +patchStrategy=merge     // +listType=map     // +listMapKey=type     Conditions []metav1.Condition `json:\"conditions,omitempty\" patchStrategy:\"merge\" patchMergeKey:\"type\" protobuf:\"bytes,1,rep,name=conditions\"` \n     // other fields }"
+                        "properties" = {
+                          "lastTransitionTime" = {
+                            "description" = "lastTransitionTime is the last time the condition transitioned from one status to another. This should be when the underlying condition changed.  If that is not known, then using the time when the API field changed is acceptable."
+                            "format" = "date-time"
+                            "type" = "string"
+                          }
+                          "message" = {
+                            "description" = "message is a human readable message indicating details about the transition. This may be an empty string."
+                            "maxLength" = 32768
+                            "type" = "string"
+                          }
+                          "observedGeneration" = {
+                            "description" = "observedGeneration represents the .metadata.generation that the condition was set based upon. For instance, if .metadata.generation is currently 12, but the .status.conditions[x].observedGeneration is 9, the condition is out of date with respect to the current state of the instance."
+                            "format" = "int64"
+                            "minimum" = 0
+                            "type" = "integer"
+                          }
+                          "reason" = {
+                            "description" = "reason contains a programmatic identifier indicating the reason for the condition's last transition. Producers of specific condition types may define expected values and meanings for this field, and whether the values are considered a guaranteed API. The value should be a CamelCase string. This field may not be empty."
+                            "maxLength" = 1024
+                            "minLength" = 1
+                            "pattern" = "^[A-Za-z]([A-Za-z0-9_,:]*[A-Za-z0-9_])?$"
+                            "type" = "string"
+                          }
+                          "status" = {
+                            "description" = "status of the condition, one of True, False, Unknown."
+                            "enum" = [
+                              "True",
+                              "False",
+                              "Unknown",
+                            ]
+                            "type" = "string"
+                          }
+                          "type" = {
+                            "description" = "type of condition in CamelCase or in foo.example.com/CamelCase. --- Many .condition.type values are consistent across resources like Available, but because arbitrary conditions can be useful (see .node.status.conditions), the ability to deconflict is important. The regex it matches is (dns1123SubdomainFmt/)?(qualifiedNameFmt)"
+                            "maxLength" = 316
+                            "pattern" = "^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])$"
+                            "type" = "string"
+                          }
+                        }
+                        "required" = [
+                          "lastTransitionTime",
+                          "message",
+                          "reason",
+                          "status",
+                          "type",
+                        ]
+                        "type" = "object"
+                      }
+                      "type" = "array"
+                      "x-kubernetes-list-map-keys" = [
+                        "type",
+                      ]
+                      "x-kubernetes-list-type" = "map"
+                    }
                     "created" = {
                       "type" = "boolean"
                     }
+                    "engineVersion" = {
+                      "description" = "EngineVersion is the KV engine version that the secret was last written with."
+                      "type" = "string"
+                    }
+                    "observedGeneration" = {
+                      "format" = "int64"
+                      "type" = "integer"
+                    }
+                    "path" = {
+                      "description" = "Path is the rendered spec.path that the secret was last written to."
+                      "type" = "string"
+                    }
+                    "pathTemplate" = {
+                      "description" = "PathTemplate is the spec.path that status.path was rendered from. The path is only rendered again when spec.path changes."
+                      "type" = "string"
+                    }
                   }
                   "type" = "object"
                 }
@@ -193,21 +617,83 @@ resource "kubernetes_manifest" "customresourcedefinition_partialkmsvaultsecrets_
                     "secrets" = {
                       "items" = {
                         "properties" = {
+                          "bundle" = {
+                            "description" = "Bundle makes the plaintext a document whose keys are written as separate secrets, instead of writing the plaintext to Key."
+                            "properties" = {
+                              "envelope" = {
+                                "description" = "Envelope is set if encryptedSecret is an envelope, i.e. a document encrypted with a data key that is encrypted with KMS, for documents larger than what KMS can encrypt directly."
+                                "type" = "boolean"
+                              }
+                              "exclude" = {
+                                "description" = "Exclude are glob patterns of the keys that are not written, even if they match Include."
+                                "items" = {
+                                  "type" = "string"
+                                }
+                                "type" = "array"
+                              }
+                              "format" = {
+                                "description" = "Format is the format of the document."
+                                "enum" = [
+                                  "dotenv",
+                                  "json",
+                                  "yaml",
+                                ]
+                                "type" = "string"
+                              }
+                              "include" = {
+                                "description" = "Include are glob patterns of the keys that are written. If empty, every key is written."
+                                "items" = {
+                                  "type" = "string"
+                                }
+                                "type" = "array"
+                              }
+                              "prefix" = {
+                                "description" = "Prefix is added to the key of every secret of the bundle."
+                                "type" = "string"
+                              }
+                            }
+                            "required" = [
+                              "format",
+                            ]
+                            "type" = "object"
+                          }
                           "emptySecret" = {
                             "type" = "boolean"
                           }
                           "encryptedSecret" = {
                             "type" = "string"
                           }
+                          "format" = {
+                            "description" = "Format is how the plaintext is parsed before it's written to Vault. A string is written as is, json and yaml are written as the object, list, number, etc. that they hold, and base64 is decoded and written as a string."
+                            "enum" = [
+                              "string",
+                              "json",
+                              "yaml",
+                              "base64",
+                            ]
+                            "type" = "string"
+                          }
                           "key" = {
                             "type" = "string"
                           }
+                          "outputEncoding" = {
+                            "description" = "OutputEncoding is how the value is written to Vault. With raw, it's written as is, and has to be valid UTF-8. With base64, it's written base64-encoded, which is how binary values are written. It can only be base64 if the format is string or base64."
+                            "enum" = [
+                              "raw",
+                              "base64",
+                            ]
+                            "type" = "string"
+                          }
                           "secretContext" = {
                             "additionalProperties" = {
                               "type" = "string"
                             }
                             "type" = "object"
                           }
+                          "templateOnly" = {
+                            "description" = "TemplateOnly keeps the secret out of the data written to Vault, so it's only used by templates."
+                            "type" = "boolean"
+                          }
                         }
                         "required" = [
                           "key",
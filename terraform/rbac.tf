@@ -18,7 +18,7 @@ resource kubernetes_cluster_role_v1 kms_vault_operator {
   rule {
     verbs      = ["*"]
     api_groups = ["k8s.patoarvizu.dev"]
-    resources  = ["kmsvaultsecrets", "partialkmsvaultsecrets"]
+    resources  = ["kmsvaultsecrets", "partialkmsvaultsecrets", "kmsvaultnamespaceconfigs", "kmsvaultpolicies"]
   }
 }
 
@@ -62,7 +62,7 @@ resource kubernetes_role_v1 kms_vault_operator {
   rule {
     verbs      = ["get", "list", "watch"]
     api_groups = ["k8s.patoarvizu.dev"]
-    resources  = ["kmsvaultsecrets", "partialkmsvaultsecrets"]
+    resources  = ["kmsvaultsecrets", "partialkmsvaultsecrets", "kmsvaultnamespaceconfigs"]
   }
 
   rule {
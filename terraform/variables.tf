@@ -131,6 +131,12 @@ variable enable_validating_webhook {
   description = "Create the additional resources required to create the validating webhook."
 }
 
+variable enable_mutating_webhook {
+  type = bool
+  default = false
+  description = "Create a `MutatingWebhookConfiguration` that applies defaults to `KMSVaultSecret`s. It's served by the validating webhook deployment, so it also requires `enable_validating_webhook`."
+}
+
 variable webhook_cert_manager_inject_secret {
   type = bool
   default = true
@@ -190,7 +190,46 @@ resource kubernetes_validating_webhook_configuration_v1 kms_vault_validating_web
       operations = ["CREATE", "UPDATE"]
       api_versions = ["v1alpha1"]
       api_groups = ["k8s.patoarvizu.dev"]
-      resources = ["kmsvaultsecrets", "partialkmsvaultsecrets"]
+      resources = ["kmsvaultsecrets"]
+    }
+
+    failure_policy = var.webhook_failure_policy
+
+    namespace_selector {
+      dynamic "match_expressions" {
+        for_each = var.webhook_namespace_selector_expressions
+        content {
+          key = match_expressions.value["key"]
+          operator = match_expressions.value["operator"]
+        }
+      }
+    }
+
+    side_effects = "Unknown"
+  }
+
+  webhook {
+    name = "partial-kms-vault-validating-webhook.patoarvizu.dev"
+
+    admission_review_versions = [
+      "v1beta1",
+      "v1",
+    ]
+
+    client_config {
+      service {
+        namespace = var.namespace_name
+        name      = "kms-vault-validating-webhook"
+        path      = "/partial"
+      }
+      ca_bundle = var.webhook_ca_bundle
+    }
+
+    rule {
+      operations = ["CREATE", "UPDATE", "DELETE"]
+      api_versions = ["v1alpha1"]
+      api_groups = ["k8s.patoarvizu.dev"]
+      resources = ["partialkmsvaultsecrets"]
     }
 
     failure_policy = var.webhook_failure_policy
@@ -207,9 +246,62 @@ resource kubernetes_validating_webhook_configuration_v1 kms_vault_validating_web
 
     side_effects = "Unknown"
   }
+  lifecycle {
+    ignore_changes = [
+      webhook[0].client_config[0].ca_bundle, # Ignoring changes to the ca_bundle attirbute, since this is usually dynamic
+      webhook[1].client_config[0].ca_bundle,
+    ]
+  }
+}
+
+resource kubernetes_mutating_webhook_configuration_v1 kms_vault_mutating_webhook {
+  for_each = var.enable_validating_webhook && var.enable_mutating_webhook ? {"webhook": true} : {}
+  metadata {
+    name = "kms-vault-mutating-webhook"
+    annotations = var.webhook_cert_manager_inject_secret ? {"cert-manager.io/inject-ca-from" = "${var.namespace_name}/kms-vault-validating-webhook"} : {}
+  }
+
+  webhook {
+    name = "kms-vault-mutating-webhook.patoarvizu.dev"
+
+    admission_review_versions = [
+      "v1beta1",
+      "v1",
+    ]
+
+    client_config {
+      service {
+        namespace = var.namespace_name
+        name      = "kms-vault-validating-webhook"
+        path      = "/mutate"
+      }
+      ca_bundle = var.webhook_ca_bundle
+    }
+
+    rule {
+      operations = ["CREATE"]
+      api_versions = ["v1alpha1"]
+      api_groups = ["k8s.patoarvizu.dev"]
+      resources = ["kmsvaultsecrets"]
+    }
+
+    failure_policy = var.webhook_failure_policy
+
+    namespace_selector {
+      dynamic "match_expressions" {
+        for_each = var.webhook_namespace_selector_expressions
+        content {
+          key = match_expressions.value["key"]
+          operator = match_expressions.value["operator"]
+        }
+      }
+    }
+
+    side_effects = "None"
+  }
   lifecycle {
     ignore_changes = [
       webhook[0].client_config[0].ca_bundle # Ignoring changes to the ca_bundle attirbute, since this is usually dynamic
     ]
   }
-}
\ No newline at end of file
+}